@@ -0,0 +1,123 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AdoptionPolicy determines how pre-existing resources which are not yet
+// children of the parent are treated when they are applied.
+type AdoptionPolicy string
+
+const (
+	// AdoptNone applies over pre-existing resources without adopting them,
+	// leaving any previous field managers in place. This is the default.
+	AdoptNone AdoptionPolicy = ""
+	// AdoptIfUnowned adopts pre-existing resources unless they are controlled
+	// by another owner, in which case they are skipped.
+	AdoptIfUnowned AdoptionPolicy = "IfUnowned"
+	// AdoptAlways adopts pre-existing resources, replacing any other controller.
+	AdoptAlways AdoptionPolicy = "Always"
+	// AdoptFailIfOwned adopts pre-existing resources, but fails if they are
+	// controlled by another owner.
+	AdoptFailIfOwned AdoptionPolicy = "FailIfOwned"
+)
+
+// adoption describes what should happen to a child before it is applied.
+type adoption int
+
+const (
+	// adoptionNotNeeded means the child doesn't exist or is already ours.
+	adoptionNotNeeded adoption = iota
+	// adoptionNeeded means the child exists and should be adopted.
+	adoptionNeeded
+	// adoptionSkipped means the child should not be applied.
+	adoptionSkipped
+)
+
+// prepareAdoption checks if a child already exists without belonging to the
+// parent and, if it should be adopted, removes any competing controller.
+func (r *Reconciler) prepareAdoption(ctx context.Context, child client.Object) (adoption, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(child.GetObjectKind().GroupVersionKind())
+
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); apierrors.IsNotFound(err) {
+		return adoptionNotNeeded, nil
+	} else if err != nil {
+		return adoptionNotNeeded, err
+	}
+
+	parentUID := r.parentMeta.GetUID()
+	if key, value := r.membership(); live.GetLabels()[key] == value {
+		return adoptionNotNeeded, nil
+	}
+
+	controller := metav1.GetControllerOf(live)
+	if controller == nil || controller.UID == parentUID {
+		return adoptionNeeded, nil
+	}
+
+	switch r.adoptionPolicy {
+	case AdoptIfUnowned:
+		r.logger.Info("not adopting child controlled by another owner", "kind", controller.Kind, "name", live.GetName())
+		return adoptionSkipped, nil
+	case AdoptFailIfOwned:
+		return adoptionNotNeeded, fmt.Errorf("unable to adopt %s: controlled by %s %s", referenceTo(live), controller.Kind, controller.Name)
+	}
+
+	// Only one controller is allowed, so the existing one must be removed.
+	original := live.DeepCopy()
+
+	var refs []metav1.OwnerReference
+	for _, ref := range live.GetOwnerReferences() {
+		if ref.UID != controller.UID {
+			refs = append(refs, ref)
+		}
+	}
+	live.SetOwnerReferences(refs)
+
+	if err := r.client.Patch(ctx, live, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		return adoptionNotNeeded, err
+	}
+
+	return adoptionNeeded, nil
+}
+
+// takeOverFields removes every field manager other than our own from an
+// applied child, so that fields set by previous managers are no longer
+// owned by them.
+func (r *Reconciler) takeOverFields(ctx context.Context, child client.Object) error {
+	managedFields := child.GetManagedFields()
+
+	var ours []metav1.ManagedFieldsEntry
+	for _, entry := range managedFields {
+		if entry.Manager == r.owner {
+			ours = append(ours, entry)
+		}
+	}
+
+	if len(ours) == 0 || len(ours) == len(managedFields) {
+		return nil
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"managedFields":   ours,
+			"resourceVersion": child.GetResourceVersion(),
+		},
+	}
+
+	by, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Patch(ctx, child, client.RawPatch(types.MergePatchType, by))
+}
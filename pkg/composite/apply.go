@@ -0,0 +1,160 @@
+package composite
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// childOutcome describes the outcome of applying a single child.
+type childOutcome struct {
+	// entry records the live child, if it exists.
+	entry InventoryEntry
+	// applied is true if the child was applied.
+	applied bool
+	// adopted is true if the child was adopted.
+	adopted bool
+	// skipped is true if the child was deliberately left as it is.
+	skipped bool
+	// unchanged is true if the child wasn't applied because neither it nor
+	// its desired state changed since it was last applied.
+	unchanged bool
+	// conflict is set if the child was left as it is because of a conflict.
+	conflict *ConflictError
+	// degraded is true if the child should be reported as degraded.
+	degraded bool
+	// recreated is set to the error which caused the child to be deleted and
+	// applied again, because immutable fields changed.
+	recreated error
+	// err is set if applying the child failed.
+	err error
+}
+
+// assertChild checks a child for drift, then applies it unless it is unchanged.
+// It must not modify the reconciler, so that children can be asserted concurrently.
+func (r *Reconciler) assertChild(ctx context.Context, child client.Object, previous []InventoryEntry) (childOutcome, *DriftedChild) {
+	var drift *DriftedChild
+	if r.detectDrift {
+		var err error
+		if drift, _, err = r.checkDrift(ctx, child, previous); err != nil {
+			return childOutcome{err: err}, nil
+		}
+	}
+
+	if !r.skipUnchanged {
+		return r.applyChild(ctx, child), drift
+	}
+
+	hash, err := desiredHash(r.owner, child)
+	if err != nil {
+		return childOutcome{err: &permanentError{err}}, drift
+	}
+
+	// Drifted children always need correcting.
+	if drift == nil {
+		entry, unchanged, err := r.unchangedSince(ctx, child, hash, previous)
+		if err != nil {
+			return childOutcome{err: err}, nil
+		}
+
+		if unchanged {
+			return childOutcome{entry: entry, unchanged: true}, nil
+		}
+	}
+
+	out := r.applyChild(ctx, child)
+	if out.applied {
+		out.entry = appliedEntry(out.entry, hash)
+	}
+
+	return out, drift
+}
+
+// applyChild applies a single child, adopting it and resolving conflicts as configured.
+// It must not modify the reconciler, so that children can be applied concurrently.
+func (r *Reconciler) applyChild(ctx context.Context, child client.Object) childOutcome {
+	var out childOutcome
+
+	adopt := adoptionNotNeeded
+	if r.adoptionPolicy != AdoptNone {
+		var err error
+		adopt, err = r.prepareAdoption(ctx, child)
+		if err != nil {
+			out.err = err
+			return out
+		}
+
+		if adopt == adoptionSkipped {
+			out.skipped = true
+			return out
+		}
+	}
+
+	err := r.apply(ctx, child, !r.noForce)
+	if conflict := asConflictError(child, err); conflict != nil {
+		policy := ConflictFail
+		if r.conflictResolver != nil {
+			policy = r.conflictResolver(child, conflict)
+		}
+
+		switch policy {
+		case ConflictForce:
+			err = r.apply(ctx, child, true)
+		case ConflictSkip, ConflictDegrade:
+			// The child is still desired, so make sure it won't be pruned.
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(child.GetObjectKind().GroupVersionKind())
+			if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); err != nil {
+				out.err = err
+				return out
+			}
+
+			out.entry = inventoryEntryFor(live)
+			out.skipped = true
+			out.conflict = conflict
+			out.degraded = policy == ConflictDegrade
+			return out
+		default:
+			err = conflict
+		}
+	}
+
+	if err != nil && isImmutableFieldError(err) {
+		if policy := r.recreatePolicyOf(child.GetObjectKind().GroupVersionKind(), child); policy != RecreateNever {
+			if recreateErr := r.recreate(ctx, child, policy); recreateErr != nil {
+				err = recreateErr
+			} else {
+				out.recreated, err = err, nil
+			}
+		}
+	}
+
+	if err != nil {
+		out.err = err
+		return out
+	}
+
+	if adopt == adoptionNeeded {
+		if err := r.takeOverFields(ctx, child); err != nil {
+			out.err = err
+			return out
+		}
+
+		out.adopted = true
+	}
+
+	out.entry = inventoryEntryFor(child)
+	out.applied = true
+	return out
+}
+
+// apply server-side applies a child, optionally forcing ownership of conflicting fields.
+func (r *Reconciler) apply(ctx context.Context, child client.Object, force bool) error {
+	applyOptions := []client.PatchOption{client.FieldOwner(r.owner)}
+	if force {
+		applyOptions = append(applyOptions, client.ForceOwnership)
+	}
+
+	return r.client.Patch(ctx, child, client.Apply, applyOptions...)
+}
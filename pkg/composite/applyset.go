@@ -0,0 +1,287 @@
+package composite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// ApplySetParentIDLabel is the key of the label which identifies an ApplySet parent.
+	ApplySetParentIDLabel = "applyset.kubernetes.io/id"
+	// ApplySetPartOfLabel is the key of the label which associates a child with an ApplySet.
+	ApplySetPartOfLabel = "applyset.kubernetes.io/part-of"
+	// ApplySetToolingAnnotation is the key of the annotation naming the tool managing an ApplySet.
+	ApplySetToolingAnnotation = "applyset.kubernetes.io/tooling"
+	// ApplySetGroupKindsAnnotation is the key of the annotation listing the kinds of ApplySet children.
+	ApplySetGroupKindsAnnotation = "applyset.kubernetes.io/contains-group-kinds"
+	// ApplySetNamespacesAnnotation is the key of the annotation listing the namespaces of
+	// ApplySet children, other than the namespace of the parent.
+	ApplySetNamespacesAnnotation = "applyset.kubernetes.io/additional-namespaces"
+	// InventoryAnnotation is the key of the annotation used by the ApplySetStateStore
+	// to store the inventory of children, which has no ApplySet equivalent.
+	InventoryAnnotation = "hive.wellplayed.games/composite-inventory"
+)
+
+// WithApplySet marks the parent and children with the standard ApplySet labels
+// and annotations, alongside the ParentLabel and composite state, so that
+// ApplySet-aware tools such as `kubectl apply --prune --applyset` understand
+// the children. The tooling identifies this operator, in the form `name/version`.
+//
+// Custom resource parents must have the `applyset.kubernetes.io/is-parent-type`
+// label on their CustomResourceDefinition to be recognised by kubectl.
+func WithApplySet(tooling string) Option {
+	return func(r *Reconciler) {
+		r.applySetTooling = tooling
+	}
+}
+
+// WithApplySetOnly is like WithApplySet, but replaces the ParentLabel with the
+// ApplySet part-of label, and stores the composite state in the ApplySet
+// annotations and InventoryAnnotation of the parent instead of the
+// StateAnnotation. WithStateStore may be used after this option to store the
+// composite state elsewhere.
+//
+// Children labelled only with the ParentLabel by earlier versions of an
+// operator are still pruned if they are in the inventory.
+func WithApplySetOnly(tooling string) Option {
+	return func(r *Reconciler) {
+		r.applySetTooling = tooling
+		r.applySetOnly = true
+		r.stateStore = ApplySetStateStore(tooling)
+	}
+}
+
+// ApplySetID returns the ApplySet ID of a parent of the given kind.
+func ApplySetID(parent client.Object, gvk schema.GroupVersionKind) string {
+	unencoded := strings.Join([]string{parent.GetName(), parent.GetNamespace(), gvk.Kind, gvk.Group}, ".")
+	hashed := sha256.Sum256([]byte(unencoded))
+	return fmt.Sprintf("applyset-%s-v1", base64.RawURLEncoding.EncodeToString(hashed[:]))
+}
+
+// membership returns the label which associates children with the parent.
+func (r *Reconciler) membership() (string, string) {
+	if r.applySetOnly {
+		return ApplySetPartOfLabel, r.applySetID
+	}
+
+	return ParentLabel, string(r.parentMeta.GetUID())
+}
+
+// markApplySet updates the ApplySet label and annotations of the parent to
+// match the state, if ApplySet marking is enabled.
+func (r *Reconciler) markApplySet(ctx context.Context, state *State) error {
+	if r.applySetTooling == "" {
+		return nil
+	}
+
+	original := r.parent.DeepCopyObject().(client.Object)
+	if !setApplySetMetadata(r.parent, r.applySetID, r.applySetTooling, state) {
+		return nil
+	}
+
+	return r.client.Patch(ctx, r.parent, client.MergeFrom(original))
+}
+
+// setApplySetMetadata sets the ApplySet label and annotations of a parent,
+// returning true if any changes were made.
+func setApplySetMetadata(parent client.Object, id, tooling string, state *State) bool {
+	groupKinds := make([]string, 0, len(state.DeployedKinds))
+	for _, gvk := range state.DeployedKinds {
+		groupKinds = append(groupKinds, gvk.GroupKind().String())
+	}
+	sort.Strings(groupKinds)
+
+	var namespaces []string
+	for _, ns := range state.Namespaces {
+		if ns != parent.GetNamespace() {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	madeChanges := false
+
+	parentLabels := parent.GetLabels()
+	if parentLabels == nil {
+		parentLabels = map[string]string{}
+	}
+
+	if parentLabels[ApplySetParentIDLabel] != id {
+		madeChanges = true
+		parentLabels[ApplySetParentIDLabel] = id
+		parent.SetLabels(parentLabels)
+	}
+
+	annotations := parent.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	desired := map[string]string{
+		ApplySetToolingAnnotation:    tooling,
+		ApplySetGroupKindsAnnotation: strings.Join(groupKinds, ","),
+		ApplySetNamespacesAnnotation: strings.Join(namespaces, ","),
+	}
+
+	for k, v := range desired {
+		if current, ok := annotations[k]; !ok || current != v {
+			madeChanges = true
+			annotations[k] = v
+		}
+	}
+
+	if madeChanges {
+		parent.SetAnnotations(annotations)
+	}
+
+	return madeChanges
+}
+
+type applySetStateStore struct {
+	tooling string
+}
+
+// ApplySetStateStore stores the composite state in the ApplySet annotations
+// of the parent, and the inventory of children in the InventoryAnnotation.
+// The version of each kind is resolved to its preferred version when the
+// state is loaded, and kinds which are no longer served are loaded without a
+// version.
+// Existing state in the StateAnnotation is migrated to the ApplySet annotations.
+func ApplySetStateStore(tooling string) StateStore {
+	return &applySetStateStore{tooling: tooling}
+}
+
+func (s *applySetStateStore) LoadState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, true)
+}
+
+func (s *applySetStateStore) PeekState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, false)
+}
+
+// load loads the state of a parent, migrating state from the StateAnnotation if migrate is true.
+func (s *applySetStateStore) load(ctx context.Context, c client.Client, parent client.Object, migrate bool) (*State, error) {
+	annotations := parent.GetAnnotations()
+
+	text, ok := annotations[ApplySetGroupKindsAnnotation]
+	if !ok {
+		if state, err := migrateAnnotation(ctx, c, parent, s, migrate); state != nil || err != nil {
+			return state, err
+		}
+
+		return &State{}, nil
+	}
+
+	state := &State{}
+
+	for _, gk := range splitList(text) {
+		groupKind := schema.ParseGroupKind(gk)
+
+		mapping, err := c.RESTMapper().RESTMapping(groupKind)
+		if meta.IsNoMatchError(err) {
+			state.DeployedKinds = append(state.DeployedKinds, groupKind.WithVersion(""))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		state.DeployedKinds = append(state.DeployedKinds, mapping.GroupVersionKind)
+	}
+
+	if ns := parent.GetNamespace(); ns != "" {
+		state.Namespaces = append(state.Namespaces, ns)
+	}
+
+	state.Namespaces = append(state.Namespaces, splitList(annotations[ApplySetNamespacesAnnotation])...)
+
+	if text, ok := annotations[InventoryAnnotation]; ok {
+		if err := json.Unmarshal([]byte(text), &state.Inventory); err != nil {
+			return nil, &decodeError{err}
+		}
+	}
+
+	return state, nil
+}
+
+func (s *applySetStateStore) SaveState(ctx context.Context, c client.Client, parent client.Object, state *State) error {
+	gvk, err := apiutil.GVKForObject(parent, c.Scheme())
+	if err != nil {
+		return err
+	}
+
+	original := parent.DeepCopyObject().(client.Object)
+	madeChanges := setApplySetMetadata(parent, ApplySetID(parent, gvk), s.tooling, state)
+
+	inventoryChanged, err := setInventoryAnnotation(parent, state.Inventory)
+	if err != nil {
+		return err
+	}
+
+	if !madeChanges && !inventoryChanged {
+		return nil
+	}
+
+	return c.Patch(ctx, parent, client.MergeFrom(original))
+}
+
+// setInventoryAnnotation stores an inventory in the InventoryAnnotation of a
+// parent, removing the annotation if the inventory is empty. It returns true
+// if any changes were made.
+func setInventoryAnnotation(parent client.Object, inventory []InventoryEntry) (bool, error) {
+	annotations := parent.GetAnnotations()
+	current, found := annotations[InventoryAnnotation]
+
+	if len(inventory) == 0 {
+		if !found {
+			return false, nil
+		}
+
+		delete(annotations, InventoryAnnotation)
+		parent.SetAnnotations(annotations)
+		return true, nil
+	}
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return false, err
+	}
+
+	if found && current == string(data) {
+		return false, nil
+	}
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[InventoryAnnotation] = string(data)
+	parent.SetAnnotations(annotations)
+	return true, nil
+}
+
+func (s *applySetStateStore) DeleteState(context.Context, client.Client, client.Object) error {
+	return nil
+}
+
+// splitList splits a comma-separated list, ignoring empty entries.
+func splitList(text string) []string {
+	var values []string
+
+	for _, v := range strings.Split(text, ",") {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
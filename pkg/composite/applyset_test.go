@@ -0,0 +1,135 @@
+package composite
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("ApplySet", func() {
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	secretKind := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	var parent *corev1.Secret
+
+	BeforeEach(func() {
+		parent = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: "default"},
+		}
+	})
+
+	It("should generate a stable ID per parent", func() {
+		id := ApplySetID(parent, secretKind)
+		Expect(id).To(HavePrefix("applyset-"))
+		Expect(id).To(HaveSuffix("-v1"))
+		Expect(strings.ContainsAny(id, "+/=")).To(BeFalse())
+		Expect(ApplySetID(parent, secretKind)).To(Equal(id))
+
+		parent.Namespace = "other"
+		Expect(ApplySetID(parent, secretKind)).ToNot(Equal(id))
+	})
+
+	It("should mark the parent with its kinds and additional namespaces", func() {
+		state := &State{
+			DeployedKinds: []schema.GroupVersionKind{deployment, configMap},
+			Namespaces:    []string{"default", "b", "a"},
+		}
+
+		Expect(setApplySetMetadata(parent, "id", "tool/v1", state)).To(BeTrue())
+		Expect(parent.Labels).To(HaveKeyWithValue(ApplySetParentIDLabel, "id"))
+		Expect(parent.Annotations).To(Equal(map[string]string{
+			ApplySetToolingAnnotation:    "tool/v1",
+			ApplySetGroupKindsAnnotation: "ConfigMap,Deployment.apps",
+			ApplySetNamespacesAnnotation: "a,b",
+		}))
+
+		Expect(setApplySetMetadata(parent, "id", "tool/v1", state)).To(BeFalse())
+	})
+
+	It("should label children with the ApplySet only when replacing the parent label", func() {
+		r := &Reconciler{parentMeta: parent, applySetTooling: "tool/v1", applySetID: "id"}
+
+		key, value := r.membership()
+		Expect(key).To(Equal(ParentLabel))
+		Expect(value).To(BeEmpty())
+
+		r.applySetOnly = true
+		key, value = r.membership()
+		Expect(key).To(Equal(ApplySetPartOfLabel))
+		Expect(value).To(Equal("id"))
+	})
+
+	Context("ApplySetStateStore", func() {
+		var ctx context.Context
+		var c client.Client
+
+		BeforeEach(func() {
+			ctx = context.Background()
+
+			mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{configMap.GroupVersion(), deployment.GroupVersion()})
+			mapper.Add(configMap, meta.RESTScopeNamespace)
+			mapper.Add(deployment, meta.RESTScopeNamespace)
+
+			parent.Annotations = map[string]string{StateAnnotation: `{"deployedKinds":[{"Group":"apps","Version":"v1","Kind":"Deployment"}]}`}
+			c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(parent).Build()
+			Expect(c.Get(ctx, client.ObjectKeyFromObject(parent), parent)).To(Succeed())
+		})
+
+		It("should migrate state from the annotation", func() {
+			store := ApplySetStateStore("tool/v1")
+
+			state, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.DeployedKinds).To(Equal([]schema.GroupVersionKind{deployment}))
+			Expect(parent.Annotations).ToNot(HaveKey(StateAnnotation))
+			Expect(parent.Annotations).To(HaveKeyWithValue(ApplySetGroupKindsAnnotation, "Deployment.apps"))
+		})
+
+		It("should save and load state", func() {
+			store := ApplySetStateStore("tool/v1")
+			state := &State{
+				DeployedKinds: []schema.GroupVersionKind{configMap, deployment},
+				Namespaces:    []string{"default", "other"},
+			}
+
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+
+			loaded, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(Equal(state))
+		})
+
+		It("should save and load the inventory", func() {
+			store := ApplySetStateStore("tool/v1")
+			state := &State{
+				DeployedKinds: []schema.GroupVersionKind{configMap},
+				Namespaces:    []string{"default"},
+				Inventory: []InventoryEntry{{
+					ChildReference:  ChildReference{GroupVersionKind: configMap, Namespace: "default", Name: "child", UID: "child-uid"},
+					ResourceVersion: "1",
+				}},
+			}
+
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+			Expect(parent.Annotations).To(HaveKey(InventoryAnnotation))
+
+			loaded, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(Equal(state))
+
+			state.Inventory = nil
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+			Expect(parent.Annotations).ToNot(HaveKey(InventoryAnnotation))
+		})
+	})
+})
@@ -3,13 +3,16 @@ package composite
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -64,6 +67,12 @@ func hasUID(uids []types.UID, uid types.UID) bool {
 // State describes the state of the
 type State struct {
 	DeployedKinds []schema.GroupVersionKind `json:"deployedKinds,omitempty"`
+	// Namespaces lists every namespace namespaced children may have been
+	// deployed to. Cluster-scoped children are not included.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Inventory lists every child which has been applied. Children in the
+	// inventory are pruned even if they are no longer labelled with the parent.
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
 }
 
 // EnsureKinds makes sure the given kinds are included and returns true if
@@ -90,6 +99,21 @@ func (s *State) EnsureKinds(kinds []schema.GroupVersionKind) bool {
 	return madeChanges
 }
 
+// EnsureNamespaces makes sure the given namespaces are included and returns
+// true if any changes were made.
+func (s *State) EnsureNamespaces(namespaces []string) bool {
+	madeChanges := false
+
+	for _, ns := range namespaces {
+		if !hasString(s.Namespaces, ns) {
+			madeChanges = true
+			s.Namespaces = append(s.Namespaces, ns)
+		}
+	}
+
+	return madeChanges
+}
+
 // StateAccessor is a type which can access the composite state of an object.
 type StateAccessor interface {
 	GetCompositeState() (*State, error)
@@ -139,143 +163,581 @@ func (a *stateAccessor) SetCompositeState(state *State) error {
 }
 
 // Reconciler reconciles composite resources.
+//
+// Each call is self-contained, so a Reconciler can be reused to reconcile
+// the same parent many times, and is safe to use from multiple goroutines.
+// Calls are serialized, since they all read and update the parent. Each call
+// fetches the parent again before using it, so the parent must exist and the
+// object given to New is updated in place.
 type Reconciler struct {
+	mu sync.Mutex
+
 	logger logr.Logger
 	client client.Client
 	scheme *runtime.Scheme
 	parent client.Object
 	owner  string
 
-	assertedUIDs  []types.UID
-	assertedKinds []schema.GroupVersionKind
-	parentMeta    metav1.Object
-	acc           StateAccessor
+	finalizer          string
+	adoptionPolicy     AdoptionPolicy
+	noForce            bool
+	conflictResolver   ConflictResolver
+	concurrency        int
+	waveFunc           WaveFunc
+	prunePolicyFunc    PrunePolicyFunc
+	recreatePolicyFunc RecreatePolicyFunc
+	transformers       []Transformer
+	healthChecks       *HealthChecks
+	progressingRequeue time.Duration
+
+	pruneNamespaces   []string
+	propagationPolicy metav1.DeletionPropagation
+	waitForDeletion   bool
+	applySetTooling   string
+	applySetOnly      bool
+	applySetID        string
+	statusConditions  bool
+	detectDrift       bool
+	observeOnly       bool
+	skipUnchanged     bool
+	applyResync       time.Duration
+	parentGVK         schema.GroupVersionKind
+
+	events     *EventRecorder
+	tracer     trace.Tracer
+	watcher    *DynamicWatcher
+	parentMeta metav1.Object
+	stateStore StateStore
+}
+
+// DefaultProgressingRequeue is the default delay suggested before reconciling
+// again whilst any children are still progressing.
+const DefaultProgressingRequeue = 10 * time.Second
+
+// Option configures optional behaviour of a Reconciler.
+type Option func(r *Reconciler)
+
+// WithFinalizer enables finalizer-driven cleanup of children, using the given
+// finalizer name. This should be used for parents which own cluster-scoped or
+// cross-namespace children, which can't be garbage collected by owner reference.
+func WithFinalizer(finalizer string) Option {
+	return func(r *Reconciler) {
+		r.finalizer = finalizer
+	}
+}
+
+// WithAdoptionPolicy sets how pre-existing resources which are not yet
+// children of the parent are adopted.
+func WithAdoptionPolicy(policy AdoptionPolicy) Option {
+	return func(r *Reconciler) {
+		r.adoptionPolicy = policy
+	}
+}
+
+// WithoutForceOwnership applies children without forcing ownership of fields
+// managed by others. Conflicts fail the reconcile with a ConflictError unless
+// a ConflictResolver is set.
+func WithoutForceOwnership() Option {
+	return func(r *Reconciler) {
+		r.noForce = true
+	}
+}
+
+// WithConflictResolver sets a function which chooses how to handle each child
+// whose apply conflicts with other field managers. It is only used together
+// with WithoutForceOwnership.
+func WithConflictResolver(resolver ConflictResolver) Option {
+	return func(r *Reconciler) {
+		r.conflictResolver = resolver
+	}
+}
+
+// WithConcurrency sets the maximum number of children which are applied or
+// deleted at once. Waves are still applied one at a time, and results are
+// the same regardless of concurrency.
+func WithConcurrency(workers int) Option {
+	return func(r *Reconciler) {
+		r.concurrency = workers
+	}
+}
+
+// WithPruneNamespaces restricts the namespaces searched for namespaced
+// children to prune. By default, the namespaces children were deployed to are
+// recorded in the composite state and searched.
+func WithPruneNamespaces(namespaces ...string) Option {
+	return func(r *Reconciler) {
+		r.pruneNamespaces = namespaces
+	}
+}
+
+// WithPropagationPolicy sets the propagation policy used when deleting children.
+// By default, the default policy of each kind is used.
+func WithPropagationPolicy(policy metav1.DeletionPropagation) Option {
+	return func(r *Reconciler) {
+		r.propagationPolicy = policy
+	}
+}
+
+// WithWaitForDeletion makes pruning wait for deleted children to be removed
+// before pruning earlier waves. Children which still exist are reported in
+// the result, along with the finalizers holding them up.
+func WithWaitForDeletion() Option {
+	return func(r *Reconciler) {
+		r.waitForDeletion = true
+	}
+}
+
+// WithWaveFunc sets a function used to place children in apply waves.
+// The wave annotation on a child always takes precedence.
+func WithWaveFunc(fn WaveFunc) Option {
+	return func(r *Reconciler) {
+		r.waveFunc = fn
+	}
+}
+
+// WithPrunePolicyFunc sets a function used to determine the prune policy of
+// children. The prune policy annotation on a child always takes precedence.
+func WithPrunePolicyFunc(fn PrunePolicyFunc) Option {
+	return func(r *Reconciler) {
+		r.prunePolicyFunc = fn
+	}
 }
 
-func New(logger logr.Logger, client client.Client, scheme *runtime.Scheme, parent client.Object, owner string) (*Reconciler, error) {
+// WithHealthChecks sets the registry used to assess the health of children.
+func WithHealthChecks(checks *HealthChecks) Option {
+	return func(r *Reconciler) {
+		r.healthChecks = checks
+	}
+}
+
+// WithProgressingRequeue sets the delay suggested before reconciling again
+// whilst any children are still progressing.
+func WithProgressingRequeue(delay time.Duration) Option {
+	return func(r *Reconciler) {
+		r.progressingRequeue = delay
+	}
+}
+
+func New(logger logr.Logger, client client.Client, scheme *runtime.Scheme, parent client.Object, owner string, opts ...Option) (*Reconciler, error) {
 	parentMeta, err := meta.Accessor(parent)
 	if err != nil {
 		return nil, fmt.Errorf("unable to access parent meta: %w", err)
 	}
 
-	acc := AccessState(parentMeta)
-
-	return &Reconciler{
+	r := &Reconciler{
 		logger: logger,
 		client: client,
 		scheme: scheme,
 		parent: parent,
 		owner:  owner,
 
+		healthChecks:       DefaultHealthChecks(),
+		progressingRequeue: DefaultProgressingRequeue,
+		stateStore:         AnnotationStateStore(),
+		tracer:             defaultTracer(),
+
 		parentMeta: parentMeta,
-		acc:        acc,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	// The parent kind is only required for ApplySets, but is used for metrics.
+	parentGVK, err := apiutil.GVKForObject(parent, scheme)
+	r.parentGVK = parentGVK
+
+	if r.applySetTooling != "" {
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine parent kind: %w", err)
+		}
+
+		r.applySetID = ApplySetID(parent, parentGVK)
+	}
+
+	return r, nil
 }
 
 // Reconcile child resources of a composite resource.
-func (r *Reconciler) Reconcile(ctx context.Context, children []client.Object) error {
-	state, err := r.acc.GetCompositeState()
+// The returned result is never nil, and describes the health of the children.
+// The health is degraded if reconciling fails.
+func (r *Reconciler) Reconcile(ctx context.Context, children []client.Object) (*ReconcileResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := time.Now()
+	ctx, span := r.tracer.Start(ctx, "composite.Reconcile",
+		trace.WithAttributes(objectAttributes(r.parentGVK, r.parent)...))
+
+	result := &ReconcileResult{
+		Health: Health{Status: HealthReady},
+	}
+
+	err := r.refreshParent(ctx)
+	if err == nil {
+		err = r.reconcile(ctx, children, result)
+		if r.statusConditions && r.parentMeta.GetDeletionTimestamp() == nil {
+			if statusErr := r.updateStatus(ctx, result, err); statusErr != nil {
+				err = tinyerrors.Append(err, statusErr)
+			}
+		}
+	}
+
 	if err != nil {
-		return &permanentError{err}
+		result.Health.Status = HealthDegraded
 	}
 
-	if err := r.markDesiredKinds(ctx, children, state); err != nil {
+	span.SetAttributes(healthKey.String(string(result.Health.Status)))
+	endSpan(span, "", err)
+	reconcileDuration.WithLabelValues(parentKindValues(r.parentGVK.GroupKind())...).Observe(time.Since(start).Seconds())
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, children []client.Object, result *ReconcileResult) error {
+	children, err := r.transform(children)
+	if err != nil {
 		return err
 	}
 
-	if err := r.assertChildren(ctx, children); err != nil {
+	if r.observeOnly {
+		return r.observe(ctx, children, result)
+	}
+
+	state, err := r.loadState(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := r.prune(ctx, state); err != nil {
+	if r.finalizer != "" {
+		if r.parentMeta.GetDeletionTimestamp() != nil {
+			return r.finalize(ctx, state, result)
+		}
+
+		if err := r.ensureFinalizer(ctx); err != nil {
+			return err
+		}
+	}
+
+	applied, err := r.assert(ctx, children, state, result)
+	if err != nil {
 		return err
 	}
 
+	if err := r.prune(ctx, state, result); err != nil {
+		return err
+	}
+
+	if err := r.assessHealth(applied, result); err != nil {
+		return err
+	}
+
+	r.countChildren(len(result.asserted.inventory))
 	return nil
 }
 
 // AssertChildren reconciles child resources of a composite resource without removing any existing children.
-func (r *Reconciler) AssertChildren(ctx context.Context, children []client.Object) error {
-	state, err := r.acc.GetCompositeState()
+// The result can be passed to Prune to remove every other child.
+func (r *Reconciler) AssertChildren(ctx context.Context, children []client.Object) (*ReconcileResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &ReconcileResult{}
+	if err := r.refreshParent(ctx); err != nil {
+		return result, err
+	}
+
+	children, err := r.transform(children)
 	if err != nil {
-		return &permanentError{err}
+		return result, err
 	}
 
-	if err := r.markDesiredKinds(ctx, children, state); err != nil {
-		return err
+	if r.observeOnly {
+		return result, r.observe(ctx, children, result)
 	}
 
-	if err := r.assertChildren(ctx, children); err != nil {
-		return err
+	state, err := r.loadState(ctx)
+	if err != nil {
+		return result, err
 	}
 
-	return nil
+	_, err = r.assert(ctx, children, state, result)
+	return result, err
 }
 
-// Reconcile child resources of a composite resource.
-func (r *Reconciler) Prune(ctx context.Context) error {
-	state, err := r.acc.GetCompositeState()
+// Prune removes child resources of a composite resource which were not
+// asserted by any of the given results of AssertChildren or Reconcile.
+// At least one result is required; use Teardown to remove every child.
+func (r *Reconciler) Prune(ctx context.Context, asserted *ReconcileResult, more ...*ReconcileResult) (*ReconcileResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &ReconcileResult{}
+	if asserted == nil {
+		return result, &permanentError{errors.New("unable to prune without an asserted result")}
+	}
+
+	if r.observeOnly {
+		return result, nil
+	}
+
+	for _, other := range append([]*ReconcileResult{asserted}, more...) {
+		if other != nil {
+			result.asserted.merge(&other.asserted)
+		}
+	}
+
+	if err := r.refreshParent(ctx); err != nil {
+		return result, err
+	}
+
+	state, err := r.loadState(ctx)
 	if err != nil {
-		return &permanentError{err}
+		return result, err
 	}
 
-	if err := r.prune(ctx, state); err != nil {
-		return err
+	return result, r.prune(ctx, state, result)
+}
+
+// Teardown removes all child resources of a composite resource in reverse wave order.
+// It is intended to be used whilst the parent is being deleted.
+func (r *Reconciler) Teardown(ctx context.Context) (*ReconcileResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &ReconcileResult{}
+	if r.observeOnly {
+		return result, nil
 	}
 
-	return nil
+	if err := r.refreshParent(ctx); err != nil {
+		return result, err
+	}
+
+	state, err := r.loadState(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	if err := r.prune(ctx, state, result); err != nil {
+		return result, err
+	}
+
+	parentChildCounts.forget(r.parentGVK.GroupKind(), client.ObjectKeyFromObject(r.parent))
+	r.forgetKinds()
+	return result, nil
 }
 
-// assertChildren updates or creates all child objects.
-func (r *Reconciler) assertChildren(ctx context.Context, children []client.Object) error {
-	var passError error
+// refreshParent fetches the latest version of the parent, so that a reused
+// Reconciler doesn't act on a stale copy.
+func (r *Reconciler) refreshParent(ctx context.Context) error {
+	return r.client.Get(ctx, client.ObjectKeyFromObject(r.parent), r.parent)
+}
 
-	var patchOptions []client.PatchOption
+// assert marks the kinds of all children, then applies them and records
+// them in the inventory. The children which were applied are returned.
+func (r *Reconciler) assert(ctx context.Context, children []client.Object, state *State, result *ReconcileResult) ([]client.Object, error) {
+	if err := r.markDesiredKinds(ctx, children, state, &result.asserted); err != nil {
+		return nil, err
+	}
 
-	applyOptions := append(patchOptions, client.ForceOwnership, client.FieldOwner(r.owner))
+	applied, err := r.assertChildren(ctx, children, state.Inventory, result)
+	if recordErr := r.recordInventory(ctx, state, result.asserted.inventory); recordErr != nil {
+		return applied, tinyerrors.Append(err, recordErr)
+	}
 
-	for _, child := range children {
-		objToPatch := child
+	return applied, err
+}
 
-		err := r.client.Patch(ctx, objToPatch, client.Apply, applyOptions...)
+// assertChildren updates or creates all child objects, one wave at a time,
+// and returns the children which were applied. The previous inventory is used
+// to tell which children were created or updated.
+// Later waves are not applied if any child in an earlier wave fails.
+func (r *Reconciler) assertChildren(ctx context.Context, children []client.Object, previous []InventoryEntry, result *ReconcileResult) ([]client.Object, error) {
+	orders := make([]int, len(children))
+	for idx, child := range children {
+		acc, err := meta.Accessor(child)
 		if err != nil {
-			passError = tinyerrors.Append(passError, err)
+			return nil, &permanentError{err}
+		}
+
+		orders[idx] = r.waveOf(child.GetObjectKind().GroupVersionKind(), acc)
+	}
+
+	var applied []client.Object
+
+	for _, w := range groupWaves(orders) {
+		var passError error
+		var events []childEvent
+
+		outs := make([]childOutcome, len(w.items))
+		reasons := make([]string, len(w.items))
+		drifts := make([]*DriftedChild, len(w.items))
+		r.parallel(len(w.items), func(i int) {
+			start := time.Now()
+			child := children[w.items[i]]
+			childCtx, span := r.startChildSpan(ctx, "composite.ApplyChild", child)
+
+			outs[i], drifts[i] = r.assertChild(childCtx, child, previous)
+			reasons[i] = changeReason(previous, outs[i])
+
+			endSpan(span, applyOutcome(outs[i], reasons[i]), outs[i].err)
+			observeApply(child.GetObjectKind().GroupVersionKind(), outs[i], reasons[i] != "" || outs[i].adopted, time.Since(start))
+		})
+
+		for i, idx := range w.items {
+			child := children[idx]
+			out := outs[i]
+			reason := reasons[i]
+
+			if drift := drifts[i]; drift != nil {
+				result.Drift = append(result.Drift, *drift)
+				events = append(events, driftEvent(*drift))
+				observeDrift(drift.Child.GroupVersionKind)
+			}
+
+			if out.err != nil {
+				passError = tinyerrors.Append(passError, out.err)
+				result.addChild(referenceTo(child), OutcomeFailed, out.err)
+
+				failure := EventReasonApplyFailed
+				if _, ok := out.err.(*ConflictError); ok {
+					failure = EventReasonApplyConflict
+				}
+				events = append(events, newChildEvent(corev1.EventTypeWarning, failure, referenceTo(child), out.err.Error()))
+				continue
+			}
+
+			if out.entry.UID != "" {
+				result.asserted.addEntry(out.entry)
+			}
+
+			result.addChild(referenceTo(child), outcomeOf(out, reason), nil)
+
+			if out.skipped {
+				result.Skipped = append(result.Skipped, referenceTo(child))
+			}
+
+			if out.conflict != nil {
+				result.Conflicts = append(result.Conflicts, out.conflict)
+				events = append(events, newChildEvent(corev1.EventTypeWarning, EventReasonApplyConflict, out.conflict.Child, out.conflict.Error()))
+			}
+
+			if out.degraded {
+				result.Health.add(ChildHealth{
+					Child:  out.conflict.Child,
+					Status: HealthDegraded,
+					Reason: out.conflict.Error(),
+				})
+			}
+
+			if out.adopted {
+				result.Adopted = append(result.Adopted, referenceTo(child))
+				events = append(events, newChildEvent(corev1.EventTypeNormal, EventReasonAdopted, referenceTo(child), ""))
+			}
+
+			if out.recreated != nil {
+				result.Recreated = append(result.Recreated, referenceTo(child))
+			}
+
+			if out.applied || out.unchanged {
+				applied = append(applied, child)
+
+				if reason == EventReasonRecreated {
+					events = append(events, newChildEvent(corev1.EventTypeNormal, reason, referenceTo(child), out.recreated.Error()))
+				} else if reason != "" {
+					events = append(events, newChildEvent(corev1.EventTypeNormal, reason, referenceTo(child), ""))
+				}
+			}
 		}
 
-		acc, err := meta.Accessor(objToPatch)
+		r.recordEvents(events)
+
+		if passError != nil {
+			return applied, passError
+		}
+	}
+
+	return applied, nil
+}
+
+// assessHealth assesses the health of all applied children.
+func (r *Reconciler) assessHealth(children []client.Object, result *ReconcileResult) error {
+	for _, child := range children {
+		obj, err := toUnstructured(child)
 		if err != nil {
-			r.logger.Error(err, "failed to access child metadata")
 			return &permanentError{err}
 		}
 
-		r.assertedUIDs = append(r.assertedUIDs, acc.GetUID())
+		status, reason := r.healthChecks.Assess(obj)
+		result.Health.add(ChildHealth{
+			Child:  referenceTo(obj),
+			Status: status,
+			Reason: reason,
+		})
 	}
 
-	return passError
+	if result.Health.Status == HealthProgressing {
+		result.RequeueAfter = r.progressingRequeue
+	}
+
+	return nil
 }
 
 // markDesiredKinds marks all new kinds, to make sure they can't get forgotten.
-func (r *Reconciler) markDesiredKinds(ctx context.Context, children []client.Object, state *State) error {
+func (r *Reconciler) markDesiredKinds(ctx context.Context, children []client.Object, state *State, asserted *assertion) error {
+	kinds, err := r.labelChildren(children)
+	if err != nil {
+		return err
+	}
+
+	asserted.addKinds(kinds)
+	asserted.addNamespaces(namespacesOf(children))
+
+	// State saved before namespaces were recorded has kinds but no
+	// namespaces, so its children may be in any namespace. It is left
+	// without namespaces until pruning has searched all of them, and then
+	// replaced with the asserted namespaces.
+	legacy := len(state.DeployedKinds) > 0 && len(state.Namespaces) == 0
+
+	// Both must be called, so that neither is skipped.
+	kindsChanged := state.EnsureKinds(asserted.kinds)
+	namespacesChanged := !legacy && state.EnsureNamespaces(asserted.namespaces)
+
+	if kindsChanged || namespacesChanged {
+		if err := r.saveState(ctx, state); err != nil {
+			return err
+		}
+	}
+
+	r.watchKinds(state)
+	return r.markApplySet(ctx, state)
+}
+
+// labelChildren associates all children with the parent and returns the
+// kinds of the children.
+func (r *Reconciler) labelChildren(children []client.Object) ([]schema.GroupVersionKind, error) {
 	parentKey := string(r.parentMeta.GetUID())
 
+	var kinds []schema.GroupVersionKind
+
 	for _, child := range children {
 		// Add GVK of resource to the list of GVKs we are processing.
 		gvk, err := apiutil.GVKForObject(child, r.scheme)
 		if err != nil {
-			return &permanentError{err}
+			return nil, &permanentError{err}
 		}
 
-		idx := kindIndex(r.assertedKinds, gvk.GroupKind())
+		idx := kindIndex(kinds, gvk.GroupKind())
 
 		if idx >= 0 {
-			r.assertedKinds[idx] = gvk
+			kinds[idx] = gvk
 		} else {
-			r.assertedKinds = append(r.assertedKinds, gvk)
+			kinds = append(kinds, gvk)
 		}
 
 		childMeta, err := meta.Accessor(child)
 		if err != nil {
-			return &permanentError{err}
+			return nil, &permanentError{err}
 		}
 
 		// Associate with parent.
@@ -283,14 +745,22 @@ func (r *Reconciler) markDesiredKinds(ctx context.Context, children []client.Obj
 		if childLabels == nil {
 			childLabels = map[string]string{}
 		}
-		childLabels[ParentLabel] = parentKey
+		if !r.applySetOnly {
+			childLabels[ParentLabel] = parentKey
+		}
+		if r.applySetTooling != "" {
+			childLabels[ApplySetPartOfLabel] = r.applySetID
+		}
 		childMeta.SetLabels(childLabels)
 
-		// Set resource owner to parent.
-		if childMeta.GetNamespace() != "" {
+		// Set resource owner to parent. Owner references can't cross namespaces or
+		// be used by cluster-scoped children of namespaced parents, so these children
+		// can only be cleaned up by a finalizer.
+		parentNamespace := r.parentMeta.GetNamespace()
+		if childMeta.GetNamespace() != "" && (parentNamespace == "" || parentNamespace == childMeta.GetNamespace()) {
 			err = controllerutil.SetControllerReference(r.parentMeta, childMeta, r.scheme)
 			if err != nil {
-				return &permanentError{err}
+				return nil, &permanentError{err}
 			}
 		}
 
@@ -298,15 +768,7 @@ func (r *Reconciler) markDesiredKinds(ctx context.Context, children []client.Obj
 		child.GetObjectKind().SetGroupVersionKind(gvk)
 	}
 
-	if state.EnsureKinds(r.assertedKinds) {
-		original := r.parent.DeepCopyObject().(client.Object)
-		_ = r.acc.SetCompositeState(state)
-		if err := r.client.Patch(ctx, r.parent, client.MergeFrom(original)); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return kinds, nil
 }
 
 // getDesiredUIDs retrieves the UIDs of all desired objects
@@ -335,67 +797,177 @@ func (r *Reconciler) getDesiredUIDs(ctx context.Context, children []client.Objec
 	return desiredUIDs, passError
 }
 
-// prune all old objects.
-func (r *Reconciler) prune(ctx context.Context, state *State) error {
-	parentKey := string(r.parentMeta.GetUID())
-	selector := labels.SelectorFromSet(labels.Set{
-		ParentLabel: parentKey,
-	})
+// prune all old objects, in reverse wave order, according to their prune policy.
+func (r *Reconciler) prune(ctx context.Context, state *State, result *ReconcileResult) error {
+	if err := r.resolveStateKinds(ctx, state, result); err != nil {
+		return err
+	}
 
-	var passError error
+	asserted := &result.asserted
+	items, waves, err := r.collectPrunable(ctx, state, asserted.uids)
+	if err != nil {
+		return err
+	}
 
-	for _, gvk := range state.DeployedKinds {
-		var list unstructured.UnstructuredList
-		list.SetGroupVersionKind(gvk)
+	for _, w := range waves {
+		// If pruning any resources failed, fail now.
+		if err := r.pruneWave(ctx, items, w, result); err != nil {
+			return err
+		}
 
-		match := client.MatchingLabelsSelector{Selector: selector}
-		err := r.client.List(ctx, &list, match)
+		if !r.waitForDeletion {
+			continue
+		}
+
+		// Wait for the wave to be gone before pruning earlier waves, or
+		// forgetting any kinds.
+		pending, err := r.pendingDeletion(ctx, items, w)
 		if err != nil {
 			return err
 		}
 
-		err = list.EachListItem(func(obj runtime.Object) error {
-			runtimeObj := obj.(client.Object)
+		if len(pending) > 0 {
+			result.PendingDeletion = append(result.PendingDeletion, pending...)
+			result.RequeueAfter = r.progressingRequeue
+			return nil
+		}
+	}
 
-			kind := runtimeObj.GetObjectKind()
-			kind.SetGroupVersionKind(gvk)
+	// Remove old types, namespaces and children from state.
+	if len(state.DeployedKinds) != len(asserted.kinds) || len(state.Namespaces) != len(asserted.namespaces) ||
+		!sameInventory(state.Inventory, asserted.inventory) {
+		state.DeployedKinds = asserted.kinds
+		state.Namespaces = asserted.namespaces
+		state.Inventory = asserted.inventory
+		if err := r.saveState(ctx, state); err != nil {
+			return err
+		}
 
-			acc, err := meta.Accessor(runtimeObj)
-			if err != nil {
-				r.logger.Error(err, "failed to access child metadata")
-				return &permanentError{err}
-			}
+		r.watchKinds(state)
 
-			if hasUID(r.assertedUIDs, acc.GetUID()) {
-				return nil
-			}
+		if err := r.markApplySet(ctx, state); err != nil {
+			return err
+		}
+	}
 
-			err = r.client.Delete(ctx, runtimeObj)
-			if err != nil {
-				passError = tinyerrors.Append(passError, err)
-			}
+	return nil
+}
 
-			return nil
-		})
+// prunable is a child which is no longer desired.
+type prunable struct {
+	obj    client.Object
+	policy PrunePolicy
+}
+
+// collectPrunable lists all children in the state which were not asserted
+// and may be pruned, grouped into waves in the order they should be pruned.
+// Children are found both from the inventory and by their label.
+func (r *Reconciler) collectPrunable(ctx context.Context, state *State, asserted []types.UID) ([]prunable, []wave, error) {
+	var items []prunable
+	var orders []int
+	var found []types.UID
+
+	add := func(child *metav1.PartialObjectMetadata) {
+		gvk := child.GroupVersionKind()
+		policy := r.prunePolicyOf(gvk, child)
+		if policy == PruneNever {
+			return
+		}
+
+		items = append(items, prunable{obj: child, policy: policy})
+		orders = append(orders, -r.waveOf(gvk, child))
+	}
+
+	namespaces := r.childNamespaces(state)
+	for _, gvk := range state.DeployedKinds {
+		children, err := r.listChildren(ctx, gvk, namespaces)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		for _, child := range children {
+			found = append(found, child.GetUID())
+			if !hasUID(asserted, child.GetUID()) {
+				add(child)
+			}
 		}
 	}
 
-	// If deleting any resources failed, fail now.
-	if passError != nil {
-		return passError
+	// Find any children which have lost their label.
+	unlabelled, err := r.listInventory(ctx, state.Inventory, append(found, asserted...))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Remove old types from state.
-	if len(state.DeployedKinds) != len(r.assertedKinds) {
-		original := r.parent.DeepCopyObject().(client.Object)
-		state.DeployedKinds = r.assertedKinds
-		_ = r.acc.SetCompositeState(state)
-		if err := r.client.Patch(ctx, r.parent, client.MergeFrom(original)); err != nil {
-			return err
+	for _, child := range unlabelled {
+		add(child)
+	}
+
+	return items, groupWaves(orders), nil
+}
+
+// pruneWave prunes every child in a wave.
+func (r *Reconciler) pruneWave(ctx context.Context, items []prunable, w wave, result *ReconcileResult) error {
+	var passError error
+
+	pruned := make([]bool, len(w.items))
+	errs := make([]error, len(w.items))
+	r.parallel(len(w.items), func(i int) {
+		start := time.Now()
+		item := items[w.items[i]]
+		childCtx, span := r.startChildSpan(ctx, "composite.PruneChild", item.obj)
+
+		pruned[i], errs[i] = r.pruneChild(childCtx, item)
+
+		endSpan(span, pruneOutcome(item, pruned[i], errs[i]), errs[i])
+		observePrune(item.obj.GetObjectKind().GroupVersionKind(), pruned[i], errs[i], time.Since(start))
+	})
+
+	var events []childEvent
+
+	for i, idx := range w.items {
+		item := items[idx]
+
+		if errs[i] != nil {
+			passError = tinyerrors.Append(passError, errs[i])
+			result.addChild(referenceTo(item.obj), OutcomeFailed, errs[i])
+			events = append(events, newChildEvent(corev1.EventTypeWarning, EventReasonPruneFailed, referenceTo(item.obj), errs[i].Error()))
+			continue
+		}
+
+		if !pruned[i] {
+			continue
+		}
+
+		if item.policy == PruneOrphan {
+			result.Orphaned = append(result.Orphaned, referenceTo(item.obj))
+			result.addChild(referenceTo(item.obj), OutcomeOrphaned, nil)
+			events = append(events, newChildEvent(corev1.EventTypeNormal, EventReasonOrphaned, referenceTo(item.obj), ""))
+		} else {
+			result.Pruned = append(result.Pruned, referenceTo(item.obj))
+			result.addChild(referenceTo(item.obj), OutcomePruned, nil)
+			events = append(events, newChildEvent(corev1.EventTypeNormal, EventReasonPruned, referenceTo(item.obj), ""))
 		}
 	}
 
-	return nil
+	r.recordEvents(events)
+	return passError
+}
+
+// pruneChild deletes or orphans a single child, and returns true if it did so.
+func (r *Reconciler) pruneChild(ctx context.Context, item prunable) (bool, error) {
+	if item.policy == PruneOrphan {
+		if err := r.orphan(ctx, item.obj); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	// Children which are already being deleted don't need deleting again.
+	if item.obj.GetDeletionTimestamp() != nil {
+		return false, nil
+	}
+
+	return r.deleteChild(ctx, item.obj)
 }
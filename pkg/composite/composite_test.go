@@ -2,10 +2,14 @@ package composite_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
+
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,7 +17,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/wellplayedgames/tiny-operator/pkg/composite"
@@ -102,11 +108,12 @@ var _ = Describe("Composite", func() {
 		})
 
 		var reconciler *composite.Reconciler
+		var result *composite.ReconcileResult
 		BeforeEach(func() {
 			reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
 			Expect(err).ToNot(HaveOccurred())
 
-			err := reconciler.Reconcile(ctx, children)
+			result, err = reconciler.Reconcile(ctx, children)
 			Expect(err).ToNot(HaveOccurred())
 
 			err = k8sClient.Get(ctx, parentKey, &parentResource)
@@ -123,6 +130,20 @@ var _ = Describe("Composite", func() {
 			}))
 		})
 
+		It("should write deployed namespaces", func() {
+			accessor := composite.AccessState(&parentResource)
+			state, err := accessor.GetCompositeState()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(state.Namespaces).To(Equal([]string{"default"}))
+		})
+
+		It("should report both services as ready", func() {
+			Expect(result.Health.Status).To(Equal(composite.HealthReady))
+			Expect(result.Health.Children).To(HaveLen(2))
+			Expect(result.RequeueAfter).To(BeZero())
+		})
+
 		It("should have created both services", func() {
 			svc := corev1.Service{}
 
@@ -165,7 +186,7 @@ var _ = Describe("Composite", func() {
 				children[idx] = child.DeepCopyObject().(client.Object)
 			}
 
-			err := reconciler.Reconcile(ctx, children)
+			_, err := reconciler.Reconcile(ctx, children)
 			Expect(err).ToNot(HaveOccurred())
 
 			for idx, child := range children {
@@ -176,6 +197,93 @@ var _ = Describe("Composite", func() {
 			}
 		})
 
+		It("should plan changes without making them", func() {
+			for idx, child := range sourceChildren {
+				children[idx] = child.DeepCopyObject().(client.Object)
+			}
+
+			svc := children[0].(*corev1.Service)
+			svc.Spec.Ports[0].Port = 8080
+
+			planned := []client.Object{
+				svc,
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "my-config-map",
+						Namespace: parentKey.Namespace,
+					},
+				},
+			}
+
+			plan, err := reconciler.Plan(ctx, planned)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plan.HasChanges()).To(BeTrue())
+
+			Expect(plan.Creates).To(HaveLen(1))
+			Expect(plan.Creates[0].Name).To(Equal("my-config-map"))
+
+			Expect(plan.Updates).To(HaveLen(1))
+			Expect(plan.Updates[0].Child.Name).To(Equal("service-1"))
+			Expect(plan.Updates[0].Diffs).To(ContainElement(composite.FieldDiff{
+				Path:    ".spec.ports[0].port",
+				Live:    int64(80),
+				Desired: int64(8080),
+			}))
+
+			Expect(plan.Prunes).To(HaveLen(1))
+			Expect(plan.Prunes[0].Name).To(Equal("service-2"))
+
+			live := corev1.Service{}
+			err = k8sClient.Get(ctx, types.NamespacedName{Namespace: parentKey.Namespace, Name: "service-1"}, &live)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(live.Spec.Ports[0].Port).To(Equal(int32(80)))
+
+			err = k8sClient.Get(ctx, types.NamespacedName{Namespace: parentKey.Namespace, Name: "my-config-map"}, &corev1.ConfigMap{})
+			Expect(errors.IsNotFound(err)).To(Equal(true))
+		})
+
+		It("should plan children in namespaces which would be created", func() {
+			for idx, child := range sourceChildren {
+				children[idx] = child.DeepCopyObject().(client.Object)
+			}
+
+			planned := append([]client.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "my-config-map",
+						Namespace: "planned-namespace",
+					},
+				},
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "planned-namespace",
+					},
+				},
+			}, children...)
+
+			plan, err := reconciler.Plan(ctx, planned)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(plan.Creates).To(HaveLen(2))
+			Expect(plan.Creates[0].Name).To(Equal("planned-namespace"))
+			Expect(plan.Creates[1].Name).To(Equal("my-config-map"))
+			Expect(plan.Unchanged).To(HaveLen(2))
+
+			err = k8sClient.Get(ctx, types.NamespacedName{Name: "planned-namespace"}, &corev1.Namespace{})
+			Expect(errors.IsNotFound(err)).To(Equal(true))
+		})
+
+		It("should plan no changes for unchanged children", func() {
+			for idx, child := range sourceChildren {
+				children[idx] = child.DeepCopyObject().(client.Object)
+			}
+
+			plan, err := reconciler.Plan(ctx, children)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plan.HasChanges()).To(BeFalse())
+			Expect(plan.Unchanged).To(HaveLen(2))
+		})
+
 		It("should not override non-applied fields", func() {
 			svc := children[0].(*corev1.Service)
 			svc.Spec.Type = corev1.ServiceTypeLoadBalancer
@@ -186,7 +294,7 @@ var _ = Describe("Composite", func() {
 				children[idx] = child.DeepCopyObject().(client.Object)
 			}
 
-			err = reconciler.Reconcile(ctx, children)
+			_, err = reconciler.Reconcile(ctx, children)
 			Expect(err).ToNot(HaveOccurred())
 
 			svc = children[0].(*corev1.Service)
@@ -242,7 +350,7 @@ var _ = Describe("Composite", func() {
 			},
 		}
 
-		err = reconciler.Reconcile(ctx, childrenA)
+		_, err = reconciler.Reconcile(ctx, childrenA)
 		Expect(err).ToNot(HaveOccurred())
 
 		err = k8sClient.Get(ctx, parentKey, &parentResource)
@@ -269,7 +377,7 @@ var _ = Describe("Composite", func() {
 			},
 		}
 
-		err = reconciler.Reconcile(ctx, childrenB)
+		_, err = reconciler.Reconcile(ctx, childrenB)
 		Expect(err).ToNot(HaveOccurred())
 
 		err = k8sClient.Get(ctx, parentKey, &parentResource)
@@ -289,4 +397,985 @@ var _ = Describe("Composite", func() {
 		}, &svc)
 		Expect(errors.IsNotFound(err)).To(Equal(true))
 	})
+
+	It("should apply children in wave order", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			err := k8sClient.Delete(ctx, &parentResource)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		namespace := "wave-" + parentResource.GetName()
+
+		// The config map is listed before its namespace, so would fail without waves.
+		children := []client.Object{
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-config-map",
+					Namespace: namespace,
+				},
+			},
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+
+		cm := corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "my-config-map"}, &cm)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("tearing down the children")
+
+		_, err = reconciler.Teardown(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "my-config-map"}, &cm)
+		Expect(errors.IsNotFound(err)).To(Equal(true))
+	})
+
+	It("should honour prune policies", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			err := k8sClient.Delete(ctx, &parentResource)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		makeConfigMap := func(name string, policy composite.PrunePolicy) *corev1.ConfigMap {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name + "-" + parentResource.GetName(),
+					Namespace:   parentResource.GetNamespace(),
+					Annotations: map[string]string{composite.PrunePolicyAnnotation: string(policy)},
+				},
+			}
+		}
+
+		children := []client.Object{
+			makeConfigMap("delete", composite.PruneDelete),
+			makeConfigMap("orphan", composite.PruneOrphan),
+			makeConfigMap("never", composite.PruneNever),
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, []client.Object{makeConfigMap("other", composite.PruneDelete)})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.Pruned).To(HaveLen(1))
+		Expect(result.Pruned[0].Name).To(Equal(children[0].GetName()))
+		Expect(result.Orphaned).To(HaveLen(1))
+		Expect(result.Orphaned[0].Name).To(Equal(children[1].GetName()))
+
+		cm := corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(children[0]), &cm)
+		Expect(errors.IsNotFound(err)).To(Equal(true))
+
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(children[1]), &cm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Labels).ToNot(HaveKey(composite.ParentLabel))
+		Expect(cm.OwnerReferences).To(BeEmpty())
+
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(children[2]), &cm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Labels).To(HaveKeyWithValue(composite.ParentLabel, string(parentResource.GetUID())))
+	})
+
+	It("should clean up cluster-scoped and cross-namespace children with a finalizer", func() {
+		const finalizer = "tiny-operator.wellplayed.games/test"
+
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+
+		parentKey := client.ObjectKeyFromObject(&parentResource)
+
+		children := []client.Object{
+			&rbacv1.ClusterRole{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cluster-role-" + parentResource.GetName(),
+				},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "config-map-" + parentResource.GetName(),
+					Namespace: "kube-public",
+				},
+			},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithFinalizer(finalizer))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = k8sClient.Get(ctx, parentKey, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parentResource.GetFinalizers()).To(ContainElement(finalizer))
+
+		By("deleting the parent")
+
+		err = k8sClient.Delete(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 5; i++ {
+			err = k8sClient.Get(ctx, parentKey, &parentResource)
+			if errors.IsNotFound(err) {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+
+			reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithFinalizer(finalizer))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		err = k8sClient.Get(ctx, parentKey, &parentResource)
+		Expect(errors.IsNotFound(err)).To(Equal(true))
+
+		for _, child := range children {
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), child)
+			Expect(errors.IsNotFound(err)).To(Equal(true))
+		}
+	})
+
+	It("should wait for deleted children with finalizers", func() {
+		const finalizer = "tiny-operator.wellplayed.games/test"
+
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		child := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "finalized-" + parentResource.GetName(),
+				Namespace:  parentResource.GetNamespace(),
+				Finalizers: []string{finalizer},
+			},
+		}
+
+		options := []composite.Option{
+			composite.WithPropagationPolicy(metav1.DeletePropagationBackground),
+			composite.WithWaitForDeletion(),
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, options...)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, options...)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(1))
+		Expect(result.PendingDeletion).To(HaveLen(1))
+		Expect(result.PendingDeletion[0].Child.Name).To(Equal(child.GetName()))
+		Expect(result.PendingDeletion[0].Finalizers).To(ContainElement(finalizer))
+		Expect(result.RequeueAfter).ToNot(BeZero())
+
+		By("removing the finalizer")
+
+		cm := &corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), cm)
+		Expect(err).ToNot(HaveOccurred())
+		controllerutil.RemoveFinalizer(cm, finalizer)
+		Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, options...)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err = reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.PendingDeletion).To(BeEmpty())
+	})
+
+	It("should store state in a config map", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		children := []client.Object{
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "child-" + parentResource.GetName(),
+					Namespace: parentResource.GetNamespace(),
+				},
+			},
+		}
+
+		By("reconciling with the state in an annotation")
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parentResource.GetAnnotations()).To(HaveKey(composite.StateAnnotation))
+
+		By("migrating the state to a config map")
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+			composite.WithStateStore(composite.ConfigMapStateStore("")))
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(1))
+		Expect(parentResource.GetAnnotations()).ToNot(HaveKey(composite.StateAnnotation))
+
+		cm := corev1.ConfigMap{}
+		key := client.ObjectKey{
+			Namespace: parentResource.GetNamespace(),
+			Name:      composite.StateObjectPrefix + string(parentResource.GetUID()),
+		}
+		err = k8sClient.Get(ctx, key, &cm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Data).To(HaveKey(composite.StateKey))
+	})
+
+	It("should prune inventoried children which lost their label", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		child := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unlabelled-" + parentResource.GetName(),
+				Namespace: parentResource.GetNamespace(),
+			},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err := reconciler.Inventory(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory).To(HaveLen(1))
+		Expect(inventory[0].Name).To(Equal(child.GetName()))
+		Expect(inventory[0].UID).To(Equal(child.GetUID()))
+
+		By("removing the parent label")
+
+		cm := &corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), cm)
+		Expect(err).ToNot(HaveOccurred())
+		delete(cm.Labels, composite.ParentLabel)
+		Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(1))
+
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), cm)
+		Expect(errors.IsNotFound(err)).To(Equal(true))
+
+		inventory, err = reconciler.Inventory(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory).To(BeEmpty())
+	})
+
+	It("should mark parents and children as an ApplySet", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		makeChild := func(name string) client.Object {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name + "-" + parentResource.GetName(),
+					Namespace: parentResource.GetNamespace(),
+				},
+			}
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+			composite.WithApplySetOnly("tiny-operator/v1"))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{makeChild("a"), makeChild("b")})
+		Expect(err).ToNot(HaveOccurred())
+
+		id := composite.ApplySetID(&parentResource, customResourceGVK)
+		Expect(parentResource.GetLabels()).To(HaveKeyWithValue(composite.ApplySetParentIDLabel, id))
+		Expect(parentResource.GetAnnotations()).To(HaveKeyWithValue(composite.ApplySetGroupKindsAnnotation, "ConfigMap"))
+		Expect(parentResource.GetAnnotations()).ToNot(HaveKey(composite.StateAnnotation))
+
+		cm := corev1.ConfigMap{}
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(makeChild("a")), &cm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Labels).To(HaveKeyWithValue(composite.ApplySetPartOfLabel, id))
+		Expect(cm.Labels).ToNot(HaveKey(composite.ParentLabel))
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+			composite.WithApplySetOnly("tiny-operator/v1"))
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, []client.Object{makeChild("a")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(1))
+		Expect(result.Pruned[0].Name).To(Equal(makeChild("b").GetName()))
+	})
+
+	It("should skip and report kinds which are no longer served", func() {
+		widget := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+		parentResource.SetAnnotations(map[string]string{
+			composite.StateAnnotation: `{"deployedKinds":[{"Group":"example.com","Version":"v1","Kind":"Widget"}]}`,
+		})
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.UnavailableKinds).To(Equal([]schema.GroupVersionKind{widget}))
+
+		state, err := composite.AccessState(&parentResource).GetCompositeState()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.DeployedKinds).To(BeEmpty())
+	})
+
+	It("should record events for children", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		fakeRecorder := record.NewFakeRecorder(10)
+		events := composite.NewEventRecorder(fakeRecorder, 0, 0)
+
+		child := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "events-" + parentResource.GetName(),
+				Namespace: parentResource.GetNamespace(),
+			},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithEventRecorder(events))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRecorder.Events).To(Receive(HavePrefix("Normal Created")))
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithEventRecorder(events))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRecorder.Events).ToNot(Receive())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithEventRecorder(events))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRecorder.Events).To(Receive(HavePrefix("Normal Pruned")))
+	})
+
+	It("should detect and correct drift", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		child := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "drift-" + parentResource.GetName(),
+				Namespace: parentResource.GetNamespace(),
+			},
+			Data: map[string]string{"key": "desired"},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithDriftDetection())
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Drift).To(BeEmpty())
+
+		By("modifying the child out of band")
+
+		live := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), live)).To(Succeed())
+		live.Data["key"] = "changed"
+		Expect(k8sClient.Update(ctx, live)).To(Succeed())
+
+		By("observing the drift without correcting it")
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithObserveOnly())
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Drift).To(HaveLen(1))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), live)).To(Succeed())
+		Expect(live.Data).To(HaveKeyWithValue("key", "changed"))
+
+		By("correcting the drift")
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithDriftDetection())
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Drift).To(HaveLen(1))
+		Expect(result.Drift[0].Diffs).To(ContainElement(composite.FieldDiff{Path: ".data.key", Live: "changed", Desired: "desired"}))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), live)).To(Succeed())
+		Expect(live.Data).To(HaveKeyWithValue("key", "desired"))
+	})
+
+	It("should skip applying unchanged children", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		child := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "unchanged-" + parentResource.GetName(),
+				Namespace: parentResource.GetNamespace(),
+			},
+			Data: map[string]string{"key": "desired"},
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithSkipUnchanged(0))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+
+		inventory, err := reconciler.Inventory(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory).To(HaveLen(1))
+		Expect(inventory[0].Hash).ToNot(BeEmpty())
+		Expect(inventory[0].AppliedAt).ToNot(BeNil())
+
+		By("reconciling again without changes")
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithSkipUnchanged(0))
+		Expect(err).ToNot(HaveOccurred())
+
+		skipped := child.DeepCopy()
+		result, err := reconciler.Reconcile(ctx, []client.Object{skipped})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Health.Children).To(HaveLen(1))
+		Expect(skipped.GetResourceVersion()).To(Equal(inventory[0].ResourceVersion))
+
+		By("reconciling after the child was modified out of band")
+
+		live := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), live)).To(Succeed())
+		live.Data["key"] = "changed"
+		Expect(k8sClient.Update(ctx, live)).To(Succeed())
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithSkipUnchanged(0))
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(child), live)).To(Succeed())
+		Expect(live.Data).To(HaveKeyWithValue("key", "desired"))
+	})
+
+	Context("adopting pre-existing resources", func() {
+		var parentResource, otherParent unstructured.Unstructured
+		var unowned, owned *corev1.ConfigMap
+
+		makeParent := func() unstructured.Unstructured {
+			parent := unstructured.Unstructured{}
+			parent.SetGroupVersionKind(customResourceGVK)
+			parent.SetNamespace("default")
+			parent.SetGenerateName("my-resource-")
+
+			err := k8sClient.Create(ctx, &parent)
+			Expect(err).ToNot(HaveOccurred())
+			return parent
+		}
+
+		BeforeEach(func() {
+			parentResource = makeParent()
+			otherParent = makeParent()
+
+			unowned = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "unowned-" + parentResource.GetName(),
+					Namespace: parentResource.GetNamespace(),
+				},
+				Data: map[string]string{"a": "1", "b": "2"},
+			}
+			err := k8sClient.Create(ctx, unowned.DeepCopy(), client.FieldOwner("helm"))
+			Expect(err).ToNot(HaveOccurred())
+
+			owned = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "owned-" + parentResource.GetName(),
+					Namespace: parentResource.GetNamespace(),
+				},
+			}
+			toCreate := owned.DeepCopy()
+			err = controllerutil.SetControllerReference(&otherParent, toCreate, scheme.Scheme)
+			Expect(err).ToNot(HaveOccurred())
+			err = k8sClient.Create(ctx, toCreate)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, &otherParent)).To(Succeed())
+		})
+
+		It("should adopt unowned resources and skip owned ones", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithAdoptionPolicy(composite.AdoptIfUnowned))
+			Expect(err).ToNot(HaveOccurred())
+
+			children := []client.Object{
+				&corev1.ConfigMap{ObjectMeta: *unowned.ObjectMeta.DeepCopy(), Data: map[string]string{"a": "3"}},
+				owned.DeepCopy(),
+			}
+
+			result, err := reconciler.Reconcile(ctx, children)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.Adopted).To(HaveLen(1))
+			Expect(result.Adopted[0].Name).To(Equal(unowned.Name))
+			Expect(result.Skipped).To(HaveLen(1))
+			Expect(result.Skipped[0].Name).To(Equal(owned.Name))
+
+			cm := corev1.ConfigMap{}
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(unowned), &cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Labels).To(HaveKeyWithValue(composite.ParentLabel, string(parentResource.GetUID())))
+			Expect(cm.Data).To(HaveKeyWithValue("a", "3"))
+			for _, entry := range cm.ManagedFields {
+				Expect(entry.Manager).To(Equal(owner))
+			}
+
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(owned), &cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Labels).ToNot(HaveKey(composite.ParentLabel))
+		})
+
+		It("should fail to adopt owned resources", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithAdoptionPolicy(composite.AdoptFailIfOwned))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, []client.Object{owned.DeepCopy()})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should replace the controller of owned resources when always adopting", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithAdoptionPolicy(composite.AdoptAlways))
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := reconciler.Reconcile(ctx, []client.Object{owned.DeepCopy()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Adopted).To(HaveLen(1))
+
+			cm := corev1.ConfigMap{}
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(owned), &cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(metav1.GetControllerOf(&cm).UID).To(Equal(parentResource.GetUID()))
+		})
+	})
+
+	Context("applying without force", func() {
+		var parentResource unstructured.Unstructured
+		var child *corev1.ConfigMap
+
+		BeforeEach(func() {
+			parentResource = unstructured.Unstructured{}
+			parentResource.SetGroupVersionKind(customResourceGVK)
+			parentResource.SetNamespace("default")
+			parentResource.SetGenerateName("my-resource-")
+
+			err := k8sClient.Create(ctx, &parentResource)
+			Expect(err).ToNot(HaveOccurred())
+
+			child = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "contested-" + parentResource.GetName(),
+					Namespace: parentResource.GetNamespace(),
+				},
+				Data: map[string]string{"a": "1"},
+			}
+
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+			Expect(err).ToNot(HaveOccurred())
+
+			// Another manager takes over one of our fields.
+			contested := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: child.Name, Namespace: child.Namespace},
+				Data:       map[string]string{"a": "2"},
+			}
+			contested.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+			err = k8sClient.Patch(ctx, contested, client.Apply, client.FieldOwner("other"), client.ForceOwnership)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		})
+
+		It("should return a conflict error", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithoutForceOwnership())
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+			Expect(err).To(HaveOccurred())
+
+			conflicts := composite.ConflictErrors(err)
+			Expect(conflicts).To(HaveLen(1))
+			Expect(conflicts[0].Child.Name).To(Equal(child.Name))
+			Expect(conflicts[0].Conflicts).To(ConsistOf(composite.FieldConflict{Field: ".data.a", Manager: "other"}))
+		})
+
+		It("should skip conflicting children when resolved", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithoutForceOwnership(),
+				composite.WithConflictResolver(func(client.Object, *composite.ConflictError) composite.ConflictPolicy {
+					return composite.ConflictDegrade
+				}))
+			Expect(err).ToNot(HaveOccurred())
+
+			result, err := reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Skipped).To(HaveLen(1))
+			Expect(result.Conflicts).To(HaveLen(1))
+			Expect(result.Health.Status).To(Equal(composite.HealthDegraded))
+
+			cm := corev1.ConfigMap{}
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), &cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Data).To(HaveKeyWithValue("a", "2"))
+		})
+
+		It("should force conflicting children when resolved", func() {
+			reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+				composite.WithoutForceOwnership(),
+				composite.WithConflictResolver(func(client.Object, *composite.ConflictError) composite.ConflictPolicy {
+					return composite.ConflictForce
+				}))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = reconciler.Reconcile(ctx, []client.Object{child.DeepCopy()})
+			Expect(err).ToNot(HaveOccurred())
+
+			cm := corev1.ConfigMap{}
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(child), &cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Data).To(HaveKeyWithValue("a", "1"))
+		})
+	})
+
+	It("should apply and prune children concurrently", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		makeChildren := func(n int) []client.Object {
+			children := make([]client.Object, n)
+			for idx := range children {
+				children[idx] = &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%d", parentResource.GetName(), idx),
+						Namespace: parentResource.GetNamespace(),
+					},
+				}
+			}
+			return children
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithConcurrency(4))
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, makeChildren(20))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Health.Children).To(HaveLen(20))
+		for idx, child := range result.Health.Children {
+			Expect(child.Child.Name).To(Equal(fmt.Sprintf("%s-%d", parentResource.GetName(), idx)))
+		}
+
+		reconciler, err = composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner, composite.WithConcurrency(4))
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err = reconciler.Reconcile(ctx, makeChildren(5))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(15))
+	})
+
+	It("should report the outcome of each child when reused", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		makeChild := func(name string) client.Object {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      parentResource.GetName() + "-" + name,
+					Namespace: parentResource.GetNamespace(),
+				},
+			}
+		}
+
+		outcomes := func(result *composite.ReconcileResult) map[string]composite.ChildOutcome {
+			byName := map[string]composite.ChildOutcome{}
+			for _, child := range result.Children {
+				Expect(child.Err).ToNot(HaveOccurred())
+				byName[strings.TrimPrefix(child.Child.Name, parentResource.GetName()+"-")] = child.Outcome
+			}
+			return byName
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		result, err := reconciler.Reconcile(ctx, []client.Object{makeChild("a"), makeChild("b")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outcomes(result)).To(Equal(map[string]composite.ChildOutcome{
+			"a": composite.OutcomeCreated,
+			"b": composite.OutcomeCreated,
+		}))
+
+		By("reconciling again with the same reconciler")
+
+		result, err = reconciler.Reconcile(ctx, []client.Object{makeChild("a")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outcomes(result)).To(Equal(map[string]composite.ChildOutcome{
+			"a": composite.OutcomeUnchanged,
+			"b": composite.OutcomePruned,
+		}))
+
+		By("asserting children in several calls before pruning")
+
+		first, err := reconciler.AssertChildren(ctx, []client.Object{makeChild("a")})
+		Expect(err).ToNot(HaveOccurred())
+		second, err := reconciler.AssertChildren(ctx, []client.Object{makeChild("c")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outcomes(second)).To(Equal(map[string]composite.ChildOutcome{
+			"c": composite.OutcomeCreated,
+		}))
+
+		result, err = reconciler.Prune(ctx, first, second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Children).To(BeEmpty())
+
+		result, err = reconciler.Prune(ctx, second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(outcomes(result)).To(Equal(map[string]composite.ChildOutcome{
+			"a": composite.OutcomePruned,
+		}))
+	})
+
+	It("should recreate children whose immutable fields changed", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		immutable := true
+		makeChild := func(value string, policy composite.RecreatePolicy) client.Object {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        parentResource.GetName(),
+					Namespace:   parentResource.GetNamespace(),
+					Annotations: map[string]string{composite.RecreatePolicyAnnotation: string(policy)},
+				},
+				Immutable: &immutable,
+				Data:      map[string]string{"key": value},
+			}
+		}
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{makeChild("a", composite.RecreateNever)})
+		Expect(err).ToNot(HaveOccurred())
+
+		cm := corev1.ConfigMap{}
+		key := types.NamespacedName{Namespace: parentResource.GetNamespace(), Name: parentResource.GetName()}
+		Expect(k8sClient.Get(ctx, key, &cm)).To(Succeed())
+		originalUID := cm.UID
+
+		By("failing to change an immutable field by default")
+
+		_, err = reconciler.Reconcile(ctx, []client.Object{makeChild("b", composite.RecreateNever)})
+		Expect(errors.IsInvalid(err)).To(BeTrue())
+
+		By("recreating the child when allowed")
+
+		result, err := reconciler.Reconcile(ctx, []client.Object{makeChild("b", composite.RecreateDelete)})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Recreated).To(HaveLen(1))
+		Expect(result.Children).To(HaveLen(1))
+		Expect(result.Children[0].Outcome).To(Equal(composite.OutcomeRecreated))
+
+		Expect(k8sClient.Get(ctx, key, &cm)).To(Succeed())
+		Expect(cm.UID).ToNot(Equal(originalUID))
+		Expect(cm.Data).To(HaveKeyWithValue("key", "b"))
+	})
+
+	It("should transform children before applying them", func() {
+		parentResource := unstructured.Unstructured{}
+		parentResource.SetGroupVersionKind(customResourceGVK)
+		parentResource.SetNamespace("default")
+		parentResource.SetGenerateName("my-resource-")
+
+		err := k8sClient.Create(ctx, &parentResource)
+		Expect(err).ToNot(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &parentResource)).To(Succeed())
+		}()
+
+		reconciler, err := composite.New(logger, k8sClient, scheme.Scheme, &parentResource, owner,
+			composite.WithTransformers(
+				composite.DefaultNamespace(k8sClient.RESTMapper()),
+				composite.NamePrefix(parentResource.GetName()+"-"),
+				composite.CommonLabels(map[string]string{"app.kubernetes.io/part-of": "example"}),
+			))
+		Expect(err).ToNot(HaveOccurred())
+
+		children := []client.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config"}},
+		}
+
+		// The same children are planned and then reconciled.
+		plan, err := reconciler.Plan(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Creates).To(HaveLen(1))
+		Expect(plan.Creates[0].Name).To(Equal(parentResource.GetName() + "-config"))
+
+		_, err = reconciler.Reconcile(ctx, children)
+		Expect(err).ToNot(HaveOccurred())
+
+		cm := corev1.ConfigMap{}
+		key := types.NamespacedName{Namespace: parentResource.GetNamespace(), Name: parentResource.GetName() + "-config"}
+		Expect(k8sClient.Get(ctx, key, &cm)).To(Succeed())
+		Expect(cm.Labels).To(HaveKeyWithValue("app.kubernetes.io/part-of", "example"))
+	})
 })
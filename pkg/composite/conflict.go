@@ -0,0 +1,122 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tinyerrors "github.com/wellplayedgames/tiny-operator/pkg/errors"
+)
+
+// ConflictPolicy determines what happens to a child when applying it without
+// force conflicts with another field manager.
+type ConflictPolicy string
+
+const (
+	// ConflictFail fails the reconcile with a ConflictError. This is the default.
+	ConflictFail ConflictPolicy = "Fail"
+	// ConflictForce applies the child again, taking ownership of the conflicting fields.
+	ConflictForce ConflictPolicy = "Force"
+	// ConflictSkip leaves the child as it is.
+	ConflictSkip ConflictPolicy = "Skip"
+	// ConflictDegrade leaves the child as it is and reports it as degraded.
+	ConflictDegrade ConflictPolicy = "Degrade"
+)
+
+// ConflictResolver chooses how to handle a conflict when applying a child.
+type ConflictResolver func(child client.Object, err *ConflictError) ConflictPolicy
+
+// FieldConflict describes a single field which is owned by another manager.
+type FieldConflict struct {
+	// Field is the path to the conflicting field, in the form `.spec.replicas`.
+	Field string
+	// Manager is the name of the field manager which currently owns the field.
+	Manager string
+}
+
+// ConflictError is returned when applying a child conflicts with other field managers.
+type ConflictError struct {
+	Child     ChildReference
+	Conflicts []FieldConflict
+
+	err error
+}
+
+var _ error = (*ConflictError)(nil)
+
+func (e *ConflictError) Error() string {
+	fields := make([]string, len(e.Conflicts))
+	for idx, c := range e.Conflicts {
+		fields[idx] = fmt.Sprintf("%s (%s)", c.Field, c.Manager)
+	}
+
+	return fmt.Sprintf("apply of %s conflicts with other managers: %s", e.Child, strings.Join(fields, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.err
+}
+
+// ConflictErrors returns every ConflictError contained in an error.
+func ConflictErrors(err error) []*ConflictError {
+	var errs []error
+	if comp, ok := err.(tinyerrors.CompositeError); ok {
+		errs = comp.Errors()
+	} else if err != nil {
+		errs = []error{err}
+	}
+
+	var conflicts []*ConflictError
+	for _, err := range errs {
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	return conflicts
+}
+
+var conflictManagerPattern = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// asConflictError converts an apply conflict returned by the API server into
+// a ConflictError. It returns nil for any other error.
+func asConflictError(child client.Object, err error) *ConflictError {
+	if !apierrors.IsConflict(err) {
+		return nil
+	}
+
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+
+	conflictErr := &ConflictError{
+		Child: referenceTo(child),
+		err:   err,
+	}
+
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+
+		conflict := FieldConflict{Field: cause.Field}
+		if match := conflictManagerPattern.FindStringSubmatch(cause.Message); match != nil {
+			conflict.Manager = match[1]
+		}
+
+		conflictErr.Conflicts = append(conflictErr.Conflicts, conflict)
+	}
+
+	if len(conflictErr.Conflicts) == 0 {
+		return nil
+	}
+
+	return conflictErr
+}
@@ -0,0 +1,67 @@
+package composite
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	tinyerrors "github.com/wellplayedgames/tiny-operator/pkg/errors"
+)
+
+func makeConflict() error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status: metav1.StatusFailure,
+		Code:   409,
+		Reason: metav1.StatusReasonConflict,
+		Details: &metav1.StatusDetails{
+			Causes: []metav1.StatusCause{
+				{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "kubectl-edit" using v1`,
+					Field:   ".spec.type",
+				},
+				{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "hpa" with subresource "scale" using v1`,
+					Field:   ".spec.replicas",
+				},
+			},
+		},
+	}}
+}
+
+var _ = Describe("ConflictError", func() {
+	var child *corev1.Service
+
+	BeforeEach(func() {
+		child = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+		child.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+	})
+
+	It("should parse field manager conflicts", func() {
+		err := asConflictError(child, makeConflict())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Child.Name).To(Equal("test"))
+		Expect(err.Conflicts).To(Equal([]FieldConflict{
+			{Field: ".spec.type", Manager: "kubectl-edit"},
+			{Field: ".spec.replicas", Manager: "hpa"},
+		}))
+	})
+
+	It("should ignore other errors", func() {
+		Expect(asConflictError(child, fmt.Errorf("broken"))).To(BeNil())
+		Expect(asConflictError(child, apierrors.NewConflict(schema.GroupResource{Resource: "services"}, "test", fmt.Errorf("stale")))).
+			To(BeNil())
+	})
+
+	It("should be found in composite errors", func() {
+		conflict := asConflictError(child, makeConflict())
+		err := tinyerrors.Append(fmt.Errorf("broken"), conflict)
+		Expect(ConflictErrors(err)).To(Equal([]*ConflictError{conflict}))
+	})
+})
@@ -0,0 +1,116 @@
+package composite
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PendingDeletion describes a child which has been deleted but still exists,
+// usually because it is waiting on finalizers.
+type PendingDeletion struct {
+	Child ChildReference
+	// Finalizers lists the finalizers which are preventing removal of the child.
+	Finalizers []string
+	// DeletingSince is when deletion of the child was requested.
+	DeletingSince time.Time
+}
+
+// deleteChild deletes a single child, as long as it is still the same object
+// which was listed. It returns true if the child was deleted by this call.
+func (r *Reconciler) deleteChild(ctx context.Context, obj client.Object) (bool, error) {
+	uid := obj.GetUID()
+	resourceVersion := obj.GetResourceVersion()
+
+	deleteOptions := []client.DeleteOption{
+		client.Preconditions{UID: &uid, ResourceVersion: &resourceVersion},
+	}
+	if r.propagationPolicy != "" {
+		deleteOptions = append(deleteOptions, client.PropagationPolicy(r.propagationPolicy))
+	}
+
+	err := r.client.Delete(ctx, obj, deleteOptions...)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if !apierrors.IsConflict(err) {
+		return err == nil, err
+	}
+
+	// A precondition failed. If the object has been replaced, it is no longer
+	// the child which was meant to be deleted; otherwise it was modified and
+	// the deletion should be retried.
+	live := &metav1.PartialObjectMetadata{}
+	live.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	if getErr := r.client.Get(ctx, client.ObjectKeyFromObject(obj), live); apierrors.IsNotFound(getErr) {
+		return false, nil
+	} else if getErr != nil {
+		return false, getErr
+	}
+
+	if live.GetUID() != uid {
+		r.logger.Info("not deleting replaced child", "kind", live.Kind, "name", live.GetName())
+		return false, nil
+	}
+
+	return false, err
+}
+
+// pendingDeletion lists every child in a wave which was meant to be deleted
+// but still exists.
+func (r *Reconciler) pendingDeletion(ctx context.Context, items []prunable, w wave) ([]PendingDeletion, error) {
+	pending := make([]*PendingDeletion, len(w.items))
+	errs := make([]error, len(w.items))
+
+	r.parallel(len(w.items), func(i int) {
+		item := items[w.items[i]]
+		if item.policy != PruneDelete {
+			return
+		}
+
+		live := &metav1.PartialObjectMetadata{}
+		live.SetGroupVersionKind(item.obj.GetObjectKind().GroupVersionKind())
+
+		err := r.client.Get(ctx, client.ObjectKeyFromObject(item.obj), live)
+		if apierrors.IsNotFound(err) {
+			return
+		} else if err != nil {
+			errs[i] = err
+			return
+		}
+
+		if live.GetUID() != item.obj.GetUID() {
+			return
+		}
+
+		pending[i] = newPendingDeletion(live)
+	})
+
+	var result []PendingDeletion
+	for i := range w.items {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+
+		if pending[i] != nil {
+			result = append(result, *pending[i])
+		}
+	}
+
+	return result, nil
+}
+
+func newPendingDeletion(obj client.Object) *PendingDeletion {
+	p := &PendingDeletion{
+		Child:      referenceTo(obj),
+		Finalizers: obj.GetFinalizers(),
+	}
+
+	if ts := obj.GetDeletionTimestamp(); ts != nil {
+		p.DeletingSince = ts.Time
+	}
+
+	return p
+}
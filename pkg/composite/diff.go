@@ -0,0 +1,102 @@
+package composite
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldDiff describes a single field which differs between two versions of an object.
+type FieldDiff struct {
+	// Path is the path to the field, in the form `.spec.ports[0].port`.
+	Path string
+	// Live is the current value of the field, or nil if it is not set.
+	Live interface{}
+	// Desired is the desired value of the field, or nil if it would be removed.
+	Desired interface{}
+}
+
+// ignoredMetadataFields are metadata fields which are maintained by the
+// API server and never considered part of a diff.
+var ignoredMetadataFields = []string{
+	"creationTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// normalizeForDiff returns a copy of an object without server-maintained fields.
+func normalizeForDiff(obj map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if k == "status" {
+			continue
+		}
+
+		out[k] = v
+	}
+
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		m := make(map[string]interface{}, len(metadata))
+		for k, v := range metadata {
+			m[k] = v
+		}
+
+		for _, field := range ignoredMetadataFields {
+			delete(m, field)
+		}
+
+		out["metadata"] = m
+	}
+
+	return out
+}
+
+// diffObjects lists every field which differs between the live and desired
+// versions of an unstructured object, ignoring status and server-maintained metadata.
+func diffObjects(live, desired map[string]interface{}) []FieldDiff {
+	var diffs []FieldDiff
+	diffValues("", normalizeForDiff(live), normalizeForDiff(desired), &diffs)
+	return diffs
+}
+
+func diffValues(path string, live, desired interface{}, diffs *[]FieldDiff) {
+	liveMap, liveIsMap := live.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if liveIsMap && desiredIsMap {
+		keys := make([]string, 0, len(liveMap)+len(desiredMap))
+		for k := range liveMap {
+			keys = append(keys, k)
+		}
+		for k := range desiredMap {
+			if _, ok := liveMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			diffValues(path+"."+k, liveMap[k], desiredMap[k], diffs)
+		}
+		return
+	}
+
+	liveSlice, liveIsSlice := live.([]interface{})
+	desiredSlice, desiredIsSlice := desired.([]interface{})
+	if liveIsSlice && desiredIsSlice && len(liveSlice) == len(desiredSlice) {
+		for idx := range liveSlice {
+			diffValues(fmt.Sprintf("%s[%d]", path, idx), liveSlice[idx], desiredSlice[idx], diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(live, desired) {
+		*diffs = append(*diffs, FieldDiff{
+			Path:    path,
+			Live:    live,
+			Desired: desired,
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package composite
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("diffObjects", func() {
+	var live map[string]interface{}
+
+	BeforeEach(func() {
+		live = map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":            "test",
+				"resourceVersion": "12",
+				"managedFields":   []interface{}{},
+			},
+			"spec": map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": int64(80)},
+				},
+			},
+			"status": map[string]interface{}{
+				"loadBalancer": map[string]interface{}{},
+			},
+		}
+	})
+
+	It("should ignore status and server-maintained metadata", func() {
+		desired := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":            "test",
+				"resourceVersion": "13",
+			},
+			"spec": map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": int64(80)},
+				},
+			},
+		}
+
+		Expect(diffObjects(live, desired)).To(BeEmpty())
+	})
+
+	It("should report changed, added and removed fields", func() {
+		desired := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":   "test",
+				"labels": map[string]interface{}{"app": "test"},
+			},
+			"spec": map[string]interface{}{
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(8080)},
+				},
+			},
+		}
+
+		Expect(diffObjects(live, desired)).To(Equal([]FieldDiff{
+			{Path: ".metadata.labels", Live: nil, Desired: map[string]interface{}{"app": "test"}},
+			{Path: ".spec.ports[0].name", Live: "http", Desired: nil},
+			{Path: ".spec.ports[0].port", Live: int64(80), Desired: int64(8080)},
+		}))
+	})
+})
@@ -0,0 +1,206 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	tinyerrors "github.com/wellplayedgames/tiny-operator/pkg/errors"
+)
+
+// DriftedChild describes a child which was modified out of band, so that
+// its live state no longer matches its desired state.
+type DriftedChild struct {
+	Child ChildReference
+	// Missing is true if the child no longer exists.
+	Missing bool
+	// Diffs lists the fields set by the desired child whose live values differ.
+	Diffs []FieldDiff
+}
+
+// WithDriftDetection compares each child with its live state before applying
+// it, and reports children which were modified out of band since they were
+// last applied in the result, the Drifted condition, events and metrics.
+// Drifted children are corrected by applying them as usual.
+//
+// Children are compared with the result of a server-side dry-run apply, and
+// only fields set in that result are compared, so fields defaulted by the API
+// server or set by other controllers are not considered drift.
+func WithDriftDetection() Option {
+	return func(r *Reconciler) {
+		r.detectDrift = true
+	}
+}
+
+// WithObserveOnly detects drift without correcting it. Children are never
+// applied, labelled, pruned or torn down, and the composite state and
+// finalizer are left alone, so
+// every difference between the desired and live children is reported as
+// drift, along with children which don't exist. The health of the live
+// children is still assessed.
+//
+// This is intended for auditing resources which are not yet managed by the
+// operator, before handing them over to it.
+func WithObserveOnly() Option {
+	return func(r *Reconciler) {
+		r.detectDrift = true
+		r.observeOnly = true
+	}
+}
+
+// checkDrift compares the result of applying a desired child in a dry run
+// with its live state. Outside of
+// observe-only mode, only children which have changed since they were
+// recorded in the previous inventory are compared. The live child is
+// returned if it exists.
+func (r *Reconciler) checkDrift(ctx context.Context, child client.Object, previous []InventoryEntry) (*DriftedChild, *unstructured.Unstructured, error) {
+	ref := referenceTo(child)
+
+	idx := inventoryIndex(previous, ref)
+	if idx < 0 && !r.observeOnly {
+		return nil, nil, nil
+	}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(ref.GroupVersionKind)
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); apierrors.IsNotFound(err) {
+		return &DriftedChild{Child: ref, Missing: true}, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	if idx >= 0 && !r.observeOnly {
+		if !inventoryEntryFor(live).changedSince(previous[idx]) {
+			return nil, live, nil
+		}
+	}
+
+	// The apply is always forced, so that the comparison is with the desired
+	// state even if applying it would conflict.
+	desired, err := toUnstructured(child.DeepCopyObject().(client.Object))
+	if err != nil {
+		return nil, nil, &permanentError{err}
+	}
+
+	if err := r.client.Patch(ctx, desired, client.Apply, client.DryRunAll, client.FieldOwner(r.owner), client.ForceOwnership); err != nil {
+		return nil, nil, err
+	}
+
+	diffs := diffOwned(live.Object, desired.Object)
+	if len(diffs) == 0 {
+		return nil, live, nil
+	}
+
+	return &DriftedChild{Child: referenceTo(live), Diffs: diffs}, live, nil
+}
+
+// diffOwned lists every field set in the desired version of an unstructured
+// object whose live value differs, ignoring status and server-maintained
+// metadata. Fields which are only set in the live object are ignored.
+func diffOwned(live, desired map[string]interface{}) []FieldDiff {
+	var diffs []FieldDiff
+	diffOwnedValues("", normalizeForDiff(live), normalizeForDiff(desired), &diffs)
+	return diffs
+}
+
+func diffOwnedValues(path string, live, desired interface{}, diffs *[]FieldDiff) {
+	if desired == nil {
+		return
+	}
+
+	if desiredMap, ok := desired.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(desiredMap))
+		for k := range desiredMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		liveMap, _ := live.(map[string]interface{})
+		for _, k := range keys {
+			diffOwnedValues(path+"."+k, liveMap[k], desiredMap[k], diffs)
+		}
+		return
+	}
+
+	liveSlice, liveIsSlice := live.([]interface{})
+	desiredSlice, desiredIsSlice := desired.([]interface{})
+	if liveIsSlice && desiredIsSlice && len(liveSlice) == len(desiredSlice) {
+		for idx := range desiredSlice {
+			diffOwnedValues(fmt.Sprintf("%s[%d]", path, idx), liveSlice[idx], desiredSlice[idx], diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(live, desired) {
+		*diffs = append(*diffs, FieldDiff{
+			Path:    path,
+			Live:    live,
+			Desired: desired,
+		})
+	}
+}
+
+// observe detects drift of every child without modifying anything, and
+// assesses the health of the children which exist.
+func (r *Reconciler) observe(ctx context.Context, children []client.Object, result *ReconcileResult) error {
+	var passError error
+	var live []client.Object
+	var events []childEvent
+
+	for _, child := range children {
+		// Children are not labelled, but their GVK must still be set.
+		gvk, err := apiutil.GVKForObject(child, r.scheme)
+		if err != nil {
+			return &permanentError{err}
+		}
+		child.GetObjectKind().SetGroupVersionKind(gvk)
+
+		drift, obj, err := r.checkDrift(ctx, child, nil)
+		if IsPermanentError(err) {
+			return err
+		} else if err != nil {
+			passError = tinyerrors.Append(passError, err)
+			continue
+		}
+
+		if obj != nil {
+			live = append(live, obj)
+		}
+
+		if drift != nil {
+			result.Drift = append(result.Drift, *drift)
+			events = append(events, driftEvent(*drift))
+			observeDrift(drift.Child.GroupVersionKind)
+		}
+	}
+
+	r.recordEvents(events)
+
+	if passError != nil {
+		return passError
+	}
+
+	return r.assessHealth(live, result)
+}
+
+// driftEvent creates an event describing a drifted child.
+func driftEvent(drift DriftedChild) childEvent {
+	detail := "missing"
+	if !drift.Missing {
+		paths := make([]string, 0, len(drift.Diffs))
+		for _, diff := range drift.Diffs {
+			paths = append(paths, diff.Path)
+		}
+
+		detail = "changed " + joinLimited(paths, maxStatusChildren)
+	}
+
+	return newChildEvent(corev1.EventTypeWarning, EventReasonDrifted, drift.Child, detail)
+}
@@ -0,0 +1,214 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// liveApplyClient answers dry-run applies with the live object, as the API
+// server does for applies which change nothing, and counts them.
+type liveApplyClient struct {
+	client.Client
+	applies int
+}
+
+func (c *liveApplyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch == client.Apply {
+		c.applies++
+		return c.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	}
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+var _ = Describe("Drift", func() {
+	var c client.Client
+	var r *Reconciler
+	var live *corev1.ConfigMap
+
+	desired := func() *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child"},
+			Data:       map[string]string{"key": "desired"},
+		}
+		cm.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		return cm
+	}
+
+	BeforeEach(func() {
+		live = desired()
+		live.Data["extra"] = "set by someone else"
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(live), live)).To(Succeed())
+		live.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+
+		r = &Reconciler{logger: logr.Discard(), client: &dryRunClient{c}, scheme: scheme.Scheme, detectDrift: true}
+	})
+
+	Context("diffOwned", func() {
+		It("should only compare fields which are desired", func() {
+			diffs := diffOwned(map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": int64(3),
+					"paused":   true,
+					"ports":    []interface{}{map[string]interface{}{"port": int64(80), "protocol": "TCP"}},
+				},
+				"status": map[string]interface{}{"ready": true},
+			}, map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": int64(2),
+					"ports":    []interface{}{map[string]interface{}{"port": int64(80)}},
+					"selector": nil,
+				},
+				"status": map[string]interface{}{"ready": false},
+			})
+
+			Expect(diffs).To(Equal([]FieldDiff{{Path: ".spec.replicas", Live: int64(3), Desired: int64(2)}}))
+		})
+
+		It("should compare lists of different lengths as a whole", func() {
+			diffs := diffOwned(
+				map[string]interface{}{"args": []interface{}{"a", "b"}},
+				map[string]interface{}{"args": []interface{}{"a"}},
+			)
+
+			Expect(diffs).To(HaveLen(1))
+			Expect(diffs[0].Path).To(Equal(".args"))
+		})
+	})
+
+	Context("checkDrift", func() {
+		It("should ignore children which aren't in the inventory", func() {
+			drift, _, err := r.checkDrift(context.Background(), desired(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).To(BeNil())
+		})
+
+		It("should ignore children which haven't changed since they were applied", func() {
+			live.Data["key"] = "changed"
+			Expect(c.Update(context.Background(), live)).To(Succeed())
+
+			drift, _, err := r.checkDrift(context.Background(), desired(), []InventoryEntry{inventoryEntryFor(live)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).To(BeNil())
+		})
+
+		It("should ignore changes to children which leave the generation alone", func() {
+			live.Generation = 1
+			Expect(c.Update(context.Background(), live)).To(Succeed())
+			previous := []InventoryEntry{inventoryEntryFor(live)}
+
+			live.Labels = map[string]string{"updated": "true"}
+			Expect(c.Update(context.Background(), live)).To(Succeed())
+
+			applier := &liveApplyClient{Client: c}
+			r.client = applier
+			drift, _, err := r.checkDrift(context.Background(), desired(), previous)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).To(BeNil())
+			Expect(applier.applies).To(BeZero())
+		})
+
+		It("should report children which were modified out of band", func() {
+			previous := []InventoryEntry{inventoryEntryFor(live)}
+
+			live.Data["key"] = "changed"
+			Expect(c.Update(context.Background(), live)).To(Succeed())
+
+			drift, _, err := r.checkDrift(context.Background(), desired(), previous)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).ToNot(BeNil())
+			Expect(drift.Child.Name).To(Equal("child"))
+			Expect(drift.Diffs).To(Equal([]FieldDiff{{Path: ".data.key", Live: "changed", Desired: "desired"}}))
+		})
+
+		It("should compare with the defaulted desired state", func() {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(80)}},
+				},
+			}
+			Expect(c.Create(context.Background(), service)).To(Succeed())
+			service.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+			previous := []InventoryEntry{inventoryEntryFor(service)}
+
+			// The child has changed since it was applied, so it is compared.
+			Expect(c.Update(context.Background(), service)).To(Succeed())
+
+			// The target port is defaulted from the port.
+			desired := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "service"},
+				Spec: corev1.ServiceSpec{
+					Ports: []corev1.ServicePort{{Port: 80}},
+				},
+			}
+			desired.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Service"))
+
+			r.client = &liveApplyClient{Client: c}
+			drift, _, err := r.checkDrift(context.Background(), desired, previous)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).To(BeNil())
+		})
+
+		It("should report children which were deleted out of band", func() {
+			previous := []InventoryEntry{inventoryEntryFor(live)}
+			Expect(c.Delete(context.Background(), live)).To(Succeed())
+
+			drift, _, err := r.checkDrift(context.Background(), desired(), previous)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(drift).ToNot(BeNil())
+			Expect(drift.Missing).To(BeTrue())
+		})
+	})
+
+	Context("observing only", func() {
+		BeforeEach(func() {
+			r.observeOnly = true
+			r.healthChecks = DefaultHealthChecks()
+		})
+
+		It("should report drift without modifying children", func() {
+			live.Data["key"] = "changed"
+			Expect(c.Update(context.Background(), live)).To(Succeed())
+			resourceVersion := live.GetResourceVersion()
+
+			missing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "missing"}}
+
+			result := &ReconcileResult{Health: Health{Status: HealthReady}}
+			Expect(r.reconcile(context.Background(), []client.Object{desired(), missing}, result)).To(Succeed())
+
+			Expect(result.Drift).To(HaveLen(2))
+			Expect(result.Drift[0].Diffs).To(HaveLen(1))
+			Expect(result.Drift[1].Missing).To(BeTrue())
+			Expect(result.Health.Children).To(HaveLen(1))
+
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(live), live)).To(Succeed())
+			Expect(live.GetResourceVersion()).To(Equal(resourceVersion))
+		})
+
+		It("should report drift in the status", func() {
+			parent := &corev1.ConfigMap{}
+			r.parentMeta = parent
+
+			result := &ReconcileResult{Drift: []DriftedChild{{Child: referenceTo(desired()), Missing: true}}}
+			status := &parentStatus{}
+			r.setStatus(status, result, nil)
+
+			drifted := meta.FindStatusCondition(status.Conditions, ConditionDrifted)
+			Expect(drifted.Status).To(Equal(metav1.ConditionTrue))
+			Expect(drifted.Message).To(Equal("ConfigMap default/child"))
+			Expect(meta.FindStatusCondition(status.Conditions, ConditionPruned).Status).To(Equal(metav1.ConditionUnknown))
+		})
+	})
+})
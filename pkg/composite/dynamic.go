@@ -0,0 +1,297 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DynamicWatcher watches children of kinds which are only discovered when
+// reconciling, such as those rendered from Helm charts. An informer is
+// started for each kind the first time any parent deploys it, and stopped
+// once no parent deploys it any more. Only the metadata of children with
+// the ParentLabel, or the ApplySet part-of label for parents reconciled with
+// WithApplySetOnly, is cached.
+//
+// Events for children are sent to the Source, which should be watched with
+// a handler which enqueues their parent, such as EnqueueParent.
+// A DynamicWatcher is safe to share between reconcilers.
+type DynamicWatcher struct {
+	logger logr.Logger
+	client metadata.Interface
+	mapper meta.RESTMapper
+	events chan event.GenericEvent
+
+	mu      sync.Mutex
+	ctx     context.Context
+	watches map[watchKey]*kindWatch
+}
+
+// watchKey identifies the children selected by a kindWatch.
+type watchKey struct {
+	gk    schema.GroupKind
+	label string
+}
+
+// kindWatch is an informer for children of a single kind with a label,
+// shared by all parents which deploy children of that kind.
+type kindWatch struct {
+	gvk     schema.GroupVersionKind
+	label   string
+	parents map[types.UID]struct{}
+	cancel  context.CancelFunc
+}
+
+var _ manager.Runnable = (*DynamicWatcher)(nil)
+
+// NewDynamicWatcher creates a DynamicWatcher using the given metadata client
+// and REST mapper. It must be started, usually by adding it to a manager.
+func NewDynamicWatcher(logger logr.Logger, client metadata.Interface, mapper meta.RESTMapper) *DynamicWatcher {
+	return &DynamicWatcher{
+		logger:  logger,
+		client:  client,
+		mapper:  mapper,
+		events:  make(chan event.GenericEvent),
+		watches: map[watchKey]*kindWatch{},
+	}
+}
+
+// WithDynamicWatcher makes the reconciler watch the kinds of its children
+// with the given watcher whenever the composite state changes, and stop
+// watching them when the parent is torn down or finalized.
+//
+// Parents which are deleted without a finalizer are not forgotten until
+// Forget is called for them.
+func WithDynamicWatcher(watcher *DynamicWatcher) Option {
+	return func(r *Reconciler) {
+		r.watcher = watcher
+	}
+}
+
+// WatchDynamically creates a DynamicWatcher for children of parents of the
+// same kind as the given parent, adds it to the manager and wires its events
+// to the builder, so that parents are reconciled whenever a child changes.
+// Parents are indexed by UID, as with WatchChildren.
+func WatchDynamically(ctx context.Context, mgr manager.Manager, b *builder.Builder, parent client.Object) (*builder.Builder, *DynamicWatcher, error) {
+	metadataClient, err := metadata.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create metadata client: %w", err)
+	}
+
+	if err := IndexParents(ctx, mgr.GetFieldIndexer(), parent); err != nil {
+		return nil, nil, fmt.Errorf("unable to index parents: %w", err)
+	}
+
+	logger := mgr.GetLogger().WithName("composite")
+	enqueue, err := EnqueueParent(logger, mgr.GetClient(), mgr.GetScheme(), parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watcher := NewDynamicWatcher(logger, metadataClient, mgr.GetRESTMapper())
+	if err := mgr.Add(watcher); err != nil {
+		return nil, nil, err
+	}
+
+	return b.Watches(watcher.Source(), enqueue), watcher, nil
+}
+
+// Source returns the source of events for watched children.
+func (w *DynamicWatcher) Source() source.Source {
+	return &source.Channel{Source: w.events}
+}
+
+// Start starts informers for every kind watched so far, and runs them until
+// the context is done.
+func (w *DynamicWatcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	w.ctx = ctx
+	for _, kw := range w.watches {
+		if err := w.startInformer(kw); err != nil {
+			w.logger.Error(err, "unable to watch kind", "kind", kw.gvk)
+		}
+	}
+	w.mu.Unlock()
+
+	<-ctx.Done()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, kw := range w.watches {
+		if kw.cancel != nil {
+			kw.cancel()
+			kw.cancel = nil
+		}
+	}
+
+	return nil
+}
+
+// Watch watches children of the given kinds with the ParentLabel on behalf
+// of a parent, and stops watching kinds which the parent previously deployed
+// but no longer does, unless another parent still deploys them.
+func (w *DynamicWatcher) Watch(parent types.UID, kinds []schema.GroupVersionKind) error {
+	return w.WatchLabelled(parent, ParentLabel, kinds)
+}
+
+// WatchLabelled is like Watch, but watches children with the given label
+// instead of the ParentLabel, such as the ApplySetPartOfLabel.
+func (w *DynamicWatcher) WatchLabelled(parent types.UID, label string, kinds []schema.GroupVersionKind) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var watchError error
+	wanted := map[watchKey]bool{}
+
+	for _, gvk := range kinds {
+		key := watchKey{gk: gvk.GroupKind(), label: label}
+		wanted[key] = true
+
+		kw, ok := w.watches[key]
+		if !ok {
+			kw = &kindWatch{gvk: gvk, label: label, parents: map[types.UID]struct{}{}}
+			w.watches[key] = kw
+		}
+
+		kw.parents[parent] = struct{}{}
+
+		if kw.cancel == nil && w.ctx != nil {
+			if err := w.startInformer(kw); err != nil {
+				watchError = err
+			}
+		}
+	}
+
+	for key, kw := range w.watches {
+		if !wanted[key] {
+			w.release(key, kw, parent)
+		}
+	}
+
+	return watchError
+}
+
+// Forget stops watching every kind on behalf of a parent.
+func (w *DynamicWatcher) Forget(parent types.UID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, kw := range w.watches {
+		w.release(key, kw, parent)
+	}
+}
+
+// Watching returns true if children of a kind are being watched.
+func (w *DynamicWatcher) Watching(gk schema.GroupKind) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, kw := range w.watches {
+		if key.gk == gk && kw.cancel != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// release stops a parent using a kind, stopping its informer if no other
+// parent uses it. The lock must be held.
+func (w *DynamicWatcher) release(key watchKey, kw *kindWatch, parent types.UID) {
+	delete(kw.parents, parent)
+	if len(kw.parents) > 0 {
+		return
+	}
+
+	if kw.cancel != nil {
+		kw.cancel()
+	}
+
+	delete(w.watches, key)
+}
+
+// startInformer starts an informer for a kind. The lock must be held.
+func (w *DynamicWatcher) startInformer(kw *kindWatch) error {
+	mapping, err := w.mapper.RESTMapping(kw.gvk.GroupKind(), kw.gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	informer := metadatainformer.NewFilteredMetadataInformer(w.client, mapping.Resource, metav1.NamespaceAll, 0, cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = kw.label
+		}).Informer()
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			w.send(ctx, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			w.send(ctx, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			w.send(ctx, obj)
+		},
+	})
+
+	go informer.Run(ctx.Done())
+
+	kw.cancel = cancel
+	w.logger.V(1).Info("watching children", "kind", kw.gvk, "label", kw.label)
+	return nil
+}
+
+// send sends an event for a child, unless the informer has been stopped.
+func (w *DynamicWatcher) send(ctx context.Context, obj interface{}) {
+	child, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return
+	}
+
+	select {
+	case w.events <- event.GenericEvent{Object: child}:
+	case <-ctx.Done():
+	}
+}
+
+// watchKinds updates the kinds watched on behalf of the parent, if the
+// reconciler has a watcher. Failures are logged, since they don't affect
+// the children.
+func (r *Reconciler) watchKinds(state *State) {
+	if r.watcher == nil {
+		return
+	}
+
+	label, _ := r.membership()
+	if err := r.watcher.WatchLabelled(r.parentMeta.GetUID(), label, state.DeployedKinds); err != nil {
+		r.logger.Error(err, "unable to watch children")
+	}
+}
+
+// forgetKinds stops watching kinds on behalf of the parent, if the
+// reconciler has a watcher.
+func (r *Reconciler) forgetKinds() {
+	if r.watcher != nil {
+		r.watcher.Forget(r.parentMeta.GetUID())
+	}
+}
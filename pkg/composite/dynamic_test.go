@@ -0,0 +1,126 @@
+package composite
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("DynamicWatcher", func() {
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	secret := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+
+	var client *metadatafake.FakeMetadataClient
+	var watcher *DynamicWatcher
+	var cancel context.CancelFunc
+	var done chan error
+
+	BeforeEach(func() {
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{configMap.GroupVersion()})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+		mapper.Add(secret, meta.RESTScopeNamespace)
+
+		scheme := metadatafake.NewTestScheme()
+		Expect(metav1.AddMetaToScheme(scheme)).To(Succeed())
+		client = metadatafake.NewSimpleMetadataClient(scheme)
+		watcher = NewDynamicWatcher(logr.Discard(), client, mapper)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan error, 1)
+		go func() {
+			done <- watcher.Start(ctx)
+		}()
+
+		Eventually(func() bool {
+			watcher.mu.Lock()
+			defer watcher.mu.Unlock()
+			return watcher.ctx != nil
+		}).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should watch kinds whilst any parent deploys them", func() {
+		Expect(watcher.Watch("a", []schema.GroupVersionKind{configMap, secret})).To(Succeed())
+		Expect(watcher.Watch("b", []schema.GroupVersionKind{configMap})).To(Succeed())
+		Expect(watcher.Watching(configMap.GroupKind())).To(BeTrue())
+		Expect(watcher.Watching(secret.GroupKind())).To(BeTrue())
+
+		Expect(watcher.Watch("a", []schema.GroupVersionKind{configMap})).To(Succeed())
+		Expect(watcher.Watching(secret.GroupKind())).To(BeFalse())
+		Expect(watcher.Watching(configMap.GroupKind())).To(BeTrue())
+
+		watcher.Forget("a")
+		Expect(watcher.Watching(configMap.GroupKind())).To(BeTrue())
+
+		watcher.Forget("b")
+		Expect(watcher.Watching(configMap.GroupKind())).To(BeFalse())
+	})
+
+	It("should send events for children", func() {
+		Expect(watcher.Watch("a", []schema.GroupVersionKind{configMap})).To(Succeed())
+
+		child := &metav1.PartialObjectMetadata{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "child",
+				Labels:    map[string]string{ParentLabel: "a"},
+			},
+		}
+
+		// Give the informer time to start watching.
+		time.Sleep(100 * time.Millisecond)
+		Expect(client.Tracker().Add(child)).To(Succeed())
+
+		var received event.GenericEvent
+		Eventually(watcher.events).Should(Receive(&received))
+		Expect(received.Object.GetName()).To(Equal("child"))
+		Expect(received.Object.GetLabels()).To(HaveKeyWithValue(ParentLabel, "a"))
+	})
+
+	It("should send events for children with the given label", func() {
+		Expect(watcher.WatchLabelled("a", ApplySetPartOfLabel, []schema.GroupVersionKind{configMap})).To(Succeed())
+		Expect(watcher.Watching(configMap.GroupKind())).To(BeTrue())
+
+		child := &metav1.PartialObjectMetadata{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "child",
+				Labels:    map[string]string{ApplySetPartOfLabel: "applyset-a"},
+			},
+		}
+
+		// Give the informer time to start watching.
+		time.Sleep(100 * time.Millisecond)
+		Expect(client.Tracker().Add(child)).To(Succeed())
+
+		var received event.GenericEvent
+		Eventually(watcher.events).Should(Receive(&received))
+		Expect(received.Object.GetLabels()).To(HaveKeyWithValue(ApplySetPartOfLabel, "applyset-a"))
+
+		Expect(watcher.Watch("a", []schema.GroupVersionKind{configMap})).To(Succeed())
+		Expect(watcher.watches).To(HaveLen(1))
+		Expect(watcher.watches).To(HaveKey(watchKey{gk: configMap.GroupKind(), label: ParentLabel}))
+	})
+
+	It("should not watch kinds which aren't served", func() {
+		widget := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+		Expect(watcher.Watch("a", []schema.GroupVersionKind{widget})).ToNot(Succeed())
+		Expect(watcher.Watching(widget.GroupKind())).To(BeFalse())
+	})
+})
@@ -0,0 +1,239 @@
+package composite
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EventReasonCreated is the reason of events for created children.
+	EventReasonCreated = "Created"
+	// EventReasonUpdated is the reason of events for updated children.
+	EventReasonUpdated = "Updated"
+	// EventReasonPruned is the reason of events for pruned children.
+	EventReasonPruned = "Pruned"
+	// EventReasonOrphaned is the reason of events for orphaned children.
+	EventReasonOrphaned = "Orphaned"
+	// EventReasonAdopted is the reason of events for adopted children.
+	EventReasonAdopted = "Adopted"
+	// EventReasonApplyConflict is the reason of events for children whose apply conflicted.
+	EventReasonApplyConflict = "ApplyConflict"
+	// EventReasonApplyFailed is the reason of events for children which failed to apply.
+	EventReasonApplyFailed = "ApplyFailed"
+	// EventReasonPruneFailed is the reason of events for children which failed to prune.
+	EventReasonPruneFailed = "PruneFailed"
+	// EventReasonDrifted is the reason of events for children which were modified out of band.
+	EventReasonDrifted = "Drifted"
+	// EventReasonRecreated is the reason of events for children which were deleted and applied again.
+	EventReasonRecreated = "Recreated"
+)
+
+const (
+	// DefaultEventInterval is the default interval within which identical
+	// events are only recorded once.
+	DefaultEventInterval = 5 * time.Minute
+	// DefaultEventAggregation is the default number of events with the same
+	// reason which are recorded individually, before being aggregated.
+	DefaultEventAggregation = 5
+)
+
+// eventVerbs describes what happened for each event reason.
+var eventVerbs = map[string]string{
+	EventReasonCreated:       "Created",
+	EventReasonUpdated:       "Updated",
+	EventReasonPruned:        "Pruned",
+	EventReasonOrphaned:      "Orphaned",
+	EventReasonAdopted:       "Adopted",
+	EventReasonApplyConflict: "Conflict applying",
+	EventReasonApplyFailed:   "Failed to apply",
+	EventReasonPruneFailed:   "Failed to prune",
+	EventReasonDrifted:       "Detected drift in",
+	EventReasonRecreated:     "Recreated",
+}
+
+// childEvent is an event about a single child.
+type childEvent struct {
+	eventType string
+	reason    string
+	child     ChildReference
+	detail    string
+}
+
+func newChildEvent(eventType, reason string, child ChildReference, detail string) childEvent {
+	return childEvent{eventType: eventType, reason: reason, child: child, detail: detail}
+}
+
+// changeReason returns the event reason for an applied child, or an empty
+// string if the child didn't change. Children which are not in the previous
+// inventory are considered created, unless they were adopted.
+func changeReason(previous []InventoryEntry, out childOutcome) string {
+	if out.recreated != nil {
+		return EventReasonRecreated
+	}
+
+	if out.adopted {
+		return ""
+	}
+
+	idx := inventoryIndex(previous, out.entry.ChildReference)
+	if idx < 0 || previous[idx].UID != out.entry.UID {
+		return EventReasonCreated
+	}
+
+	if out.entry.changedSince(previous[idx]) {
+		return EventReasonUpdated
+	}
+
+	return ""
+}
+
+// EventRecorder records events about children on their parent.
+// Identical events are only recorded once per interval, and events with the
+// same reason from a single step of a reconcile are aggregated into one if
+// there are too many of them. It is safe to share between reconcilers.
+type EventRecorder struct {
+	recorder  record.EventRecorder
+	interval  time.Duration
+	aggregate int
+	now       func() time.Time
+
+	mu        sync.Mutex
+	recorded  map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewEventRecorder creates an EventRecorder which records events with the
+// given recorder. Identical events are only recorded once per interval, and
+// more than aggregate events with the same reason are recorded as one.
+// Zero values use DefaultEventInterval and DefaultEventAggregation.
+func NewEventRecorder(recorder record.EventRecorder, interval time.Duration, aggregate int) *EventRecorder {
+	if interval == 0 {
+		interval = DefaultEventInterval
+	}
+
+	if aggregate == 0 {
+		aggregate = DefaultEventAggregation
+	}
+
+	return &EventRecorder{
+		recorder:  recorder,
+		interval:  interval,
+		aggregate: aggregate,
+		now:       time.Now,
+		recorded:  map[string]time.Time{},
+	}
+}
+
+// WithEventRecorder records events on the parent for changes to children and
+// failures.
+func WithEventRecorder(recorder *EventRecorder) Option {
+	return func(r *Reconciler) {
+		r.events = recorder
+	}
+}
+
+// recordEvents records a batch of events about children.
+func (r *Reconciler) recordEvents(events []childEvent) {
+	if r.events == nil || len(events) == 0 {
+		return
+	}
+
+	r.events.record(r.parent, events)
+}
+
+func (e *EventRecorder) record(parent client.Object, events []childEvent) {
+	var reasons []string
+	byReason := map[string][]childEvent{}
+
+	for _, event := range events {
+		if _, ok := byReason[event.reason]; !ok {
+			reasons = append(reasons, event.reason)
+		}
+
+		byReason[event.reason] = append(byReason[event.reason], event)
+	}
+
+	for _, reason := range reasons {
+		group := byReason[reason]
+		if len(group) <= e.aggregate {
+			for _, event := range group {
+				e.emit(parent, event.eventType, reason, individualMessage(event))
+			}
+			continue
+		}
+
+		e.emit(parent, aggregateType(group), reason, aggregateMessage(group, e.aggregate))
+	}
+}
+
+// emit records an event, unless it was already recorded within the interval.
+func (e *EventRecorder) emit(parent client.Object, eventType, reason, message string) {
+	if !e.shouldEmit(parent, eventType, reason, message) {
+		return
+	}
+
+	e.recorder.Event(parent, eventType, reason, message)
+}
+
+func (e *EventRecorder) shouldEmit(parent client.Object, eventType, reason, message string) bool {
+	key := strings.Join([]string{string(parent.GetUID()), eventType, reason, message}, "\x00")
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if now.Sub(e.lastSweep) > e.interval {
+		for k, t := range e.recorded {
+			if now.Sub(t) > e.interval {
+				delete(e.recorded, k)
+			}
+		}
+
+		e.lastSweep = now
+	}
+
+	if t, ok := e.recorded[key]; ok && now.Sub(t) <= e.interval {
+		return false
+	}
+
+	e.recorded[key] = now
+	return true
+}
+
+func individualMessage(event childEvent) string {
+	message := fmt.Sprintf("%s %s", eventVerbs[event.reason], event.child)
+	if event.detail != "" {
+		message += ": " + event.detail
+	}
+
+	return message
+}
+
+// aggregateMessage describes a group of events with the same reason, listing
+// at most limit children.
+func aggregateMessage(group []childEvent, limit int) string {
+	names := make([]string, 0, limit)
+	for _, event := range group[:limit] {
+		names = append(names, event.child.String())
+	}
+
+	return fmt.Sprintf("%s %d children: %s and %d more",
+		eventVerbs[group[0].reason], len(group), strings.Join(names, ", "), len(group)-limit)
+}
+
+// aggregateType returns Warning if any event in a group is a warning.
+func aggregateType(group []childEvent) string {
+	for _, event := range group {
+		if event.eventType == corev1.EventTypeWarning {
+			return corev1.EventTypeWarning
+		}
+	}
+
+	return corev1.EventTypeNormal
+}
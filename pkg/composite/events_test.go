@@ -0,0 +1,106 @@
+package composite
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Events", func() {
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	var fake *record.FakeRecorder
+	var recorder *EventRecorder
+	var now time.Time
+	var parent *corev1.ConfigMap
+
+	child := func(name string) ChildReference {
+		return ChildReference{GroupVersionKind: configMap, Namespace: "default", Name: name}
+	}
+
+	drain := func() []string {
+		var events []string
+		for {
+			select {
+			case e := <-fake.Events:
+				events = append(events, e)
+			default:
+				return events
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		fake = record.NewFakeRecorder(100)
+		recorder = NewEventRecorder(fake, time.Minute, 2)
+		now = time.Unix(0, 0)
+		recorder.now = func() time.Time { return now }
+		parent = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "parent", UID: "1"}}
+	})
+
+	It("should record events with the child kind and name", func() {
+		recorder.record(parent, []childEvent{
+			newChildEvent(corev1.EventTypeNormal, EventReasonCreated, child("a"), ""),
+			newChildEvent(corev1.EventTypeWarning, EventReasonApplyFailed, child("b"), "denied"),
+		})
+
+		Expect(drain()).To(Equal([]string{
+			"Normal Created Created ConfigMap default/a",
+			"Warning ApplyFailed Failed to apply ConfigMap default/b: denied",
+		}))
+	})
+
+	It("should aggregate many events with the same reason", func() {
+		recorder.record(parent, []childEvent{
+			newChildEvent(corev1.EventTypeNormal, EventReasonPruned, child("a"), ""),
+			newChildEvent(corev1.EventTypeNormal, EventReasonPruned, child("b"), ""),
+			newChildEvent(corev1.EventTypeNormal, EventReasonPruned, child("c"), ""),
+		})
+
+		Expect(drain()).To(Equal([]string{
+			"Normal Pruned Pruned 3 children: ConfigMap default/a, ConfigMap default/b and 1 more",
+		}))
+	})
+
+	It("should rate-limit identical events", func() {
+		events := []childEvent{newChildEvent(corev1.EventTypeNormal, EventReasonUpdated, child("a"), "")}
+
+		recorder.record(parent, events)
+		recorder.record(parent, events)
+		Expect(drain()).To(HaveLen(1))
+
+		now = now.Add(2 * time.Minute)
+		recorder.record(parent, events)
+		Expect(drain()).To(HaveLen(1))
+	})
+
+	Context("changeReason", func() {
+		previous := []InventoryEntry{{
+			ChildReference:  ChildReference{GroupVersionKind: configMap, Namespace: "default", Name: "a", UID: "1"},
+			ResourceVersion: "1",
+		}}
+
+		It("should report new children as created", func() {
+			out := childOutcome{entry: InventoryEntry{ChildReference: child("b")}}
+			Expect(changeReason(previous, out)).To(Equal(EventReasonCreated))
+		})
+
+		It("should report changed children as updated", func() {
+			out := childOutcome{entry: previous[0]}
+			Expect(changeReason(previous, out)).To(BeEmpty())
+
+			out.entry.ResourceVersion = "2"
+			Expect(changeReason(previous, out)).To(Equal(EventReasonUpdated))
+		})
+
+		It("should not report adopted children as created", func() {
+			out := childOutcome{entry: InventoryEntry{ChildReference: child("b")}, adopted: true}
+			Expect(changeReason(previous, out)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package composite
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	tinyerrors "github.com/wellplayedgames/tiny-operator/pkg/errors"
+)
+
+// ensureFinalizer adds the finalizer to the parent if it is missing.
+func (r *Reconciler) ensureFinalizer(ctx context.Context) error {
+	if controllerutil.ContainsFinalizer(r.parent, r.finalizer) {
+		return nil
+	}
+
+	original := r.parent.DeepCopyObject().(client.Object)
+	controllerutil.AddFinalizer(r.parent, r.finalizer)
+	return r.client.Patch(ctx, r.parent, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
+
+// finalize tears down the children of a parent which is being deleted, one
+// wave at a time, and removes the finalizer once all children are gone.
+func (r *Reconciler) finalize(ctx context.Context, state *State, result *ReconcileResult) error {
+	if !controllerutil.ContainsFinalizer(r.parent, r.finalizer) {
+		return nil
+	}
+
+	if err := r.resolveStateKinds(ctx, state, result); err != nil {
+		return err
+	}
+
+	items, waves, err := r.collectPrunable(ctx, state, nil)
+	if err != nil {
+		return err
+	}
+
+	if len(waves) > 0 {
+		// Only the last remaining wave is torn down, so that earlier waves
+		// outlive it. Wait for it to be gone before moving on.
+		pruneErr := r.pruneWave(ctx, items, waves[0], result)
+
+		// Orphaned children would otherwise still be found through the
+		// inventory, and the wave would never be gone.
+		if len(result.Orphaned) > 0 {
+			state.Inventory = withoutChildren(state.Inventory, result.Orphaned)
+			if err := r.saveState(ctx, state); err != nil {
+				return tinyerrors.Append(pruneErr, err)
+			}
+		}
+
+		if pruneErr != nil {
+			return pruneErr
+		}
+
+		for _, idx := range waves[0].items {
+			if obj := items[idx].obj; obj.GetDeletionTimestamp() != nil {
+				result.PendingDeletion = append(result.PendingDeletion, *newPendingDeletion(obj))
+			}
+		}
+
+		result.RequeueAfter = r.progressingRequeue
+		return nil
+	}
+
+	if err := r.stateStore.DeleteState(ctx, r.client, r.parent); err != nil {
+		return err
+	}
+
+	parentChildCounts.forget(r.parentGVK.GroupKind(), client.ObjectKeyFromObject(r.parent))
+	r.forgetKinds()
+
+	original := r.parent.DeepCopyObject().(client.Object)
+	controllerutil.RemoveFinalizer(r.parent, r.finalizer)
+	return r.client.Patch(ctx, r.parent, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+}
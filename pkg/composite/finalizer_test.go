@@ -0,0 +1,78 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("finalize", func() {
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	const finalizer = "example.com/finalizer"
+
+	It("should remove the finalizer once orphaned children are forgotten", func() {
+		ctx := context.Background()
+		now := metav1.Now()
+
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "child",
+			UID:         "child-uid",
+			Labels:      map[string]string{ParentLabel: "parent-uid"},
+			Annotations: map[string]string{PrunePolicyAnnotation: string(PruneOrphan)},
+		}}
+		child.SetGroupVersionKind(configMap)
+
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "parent",
+			UID:               "parent-uid",
+			Finalizers:        []string{finalizer},
+			DeletionTimestamp: &now,
+		}}
+		Expect(AccessState(parent).SetCompositeState(&State{
+			DeployedKinds: []schema.GroupVersionKind{configMap},
+			Namespaces:    []string{"default"},
+			Inventory:     []InventoryEntry{inventoryEntryFor(child)},
+		})).To(Succeed())
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(parent, child).Build()
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(parent), parent)).To(Succeed())
+
+		r, err := New(logr.Discard(), c, scheme.Scheme, parent, "test", WithFinalizer(finalizer))
+		Expect(err).ToNot(HaveOccurred())
+
+		By("orphaning the child")
+
+		result, err := r.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Orphaned).To(HaveLen(1))
+		Expect(parent.Finalizers).To(ConsistOf(finalizer))
+
+		state, err := r.loadState(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Inventory).To(BeEmpty())
+
+		By("removing the finalizer")
+
+		result, err = r.Reconcile(ctx, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Orphaned).To(BeEmpty())
+		Expect(parent.Finalizers).To(BeEmpty())
+
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(child), child)).To(Succeed())
+		Expect(child.Labels).ToNot(HaveKey(ParentLabel))
+	})
+})
@@ -0,0 +1,321 @@
+package composite
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HealthStatus summarises the health of a child resource.
+type HealthStatus string
+
+const (
+	// HealthReady indicates a child has converged on its desired state.
+	HealthReady HealthStatus = "Ready"
+	// HealthProgressing indicates a child is still converging on its desired state.
+	HealthProgressing HealthStatus = "Progressing"
+	// HealthDegraded indicates a child has failed to converge on its desired state.
+	HealthDegraded HealthStatus = "Degraded"
+)
+
+// severity orders health statuses from best to worst.
+func (s HealthStatus) severity() int {
+	switch s {
+	case HealthProgressing:
+		return 1
+	case HealthDegraded:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// HealthCheck assesses the health of a child resource from its live state,
+// returning the status and a human readable reason if it is not ready.
+type HealthCheck func(obj *unstructured.Unstructured) (HealthStatus, string)
+
+// ChildHealth describes the health of a single child resource.
+type ChildHealth struct {
+	Child  ChildReference
+	Status HealthStatus
+	Reason string
+}
+
+// Health describes the aggregated health of all children of a composite.
+type Health struct {
+	// Status is the worst status of any child.
+	Status HealthStatus
+	// Children contains the health of every child.
+	Children []ChildHealth
+}
+
+// add includes the health of a child in the aggregate.
+func (h *Health) add(child ChildHealth) {
+	if child.Status.severity() > h.Status.severity() {
+		h.Status = child.Status
+	}
+
+	h.Children = append(h.Children, child)
+}
+
+// HealthChecks is a registry of health checks keyed by GroupKind.
+type HealthChecks struct {
+	checks   map[schema.GroupKind]HealthCheck
+	fallback HealthCheck
+}
+
+// NewHealthChecks creates an empty health check registry. Kinds without a
+// registered check are assessed with the generic Ready condition check.
+func NewHealthChecks() *HealthChecks {
+	return &HealthChecks{
+		checks:   map[schema.GroupKind]HealthCheck{},
+		fallback: ReadyConditionHealth,
+	}
+}
+
+// DefaultHealthChecks creates a health check registry containing all of
+// the built-in checks.
+func DefaultHealthChecks() *HealthChecks {
+	h := NewHealthChecks()
+	h.Register(schema.GroupKind{Group: "apps", Kind: "Deployment"}, DeploymentHealth)
+	h.Register(schema.GroupKind{Group: "apps", Kind: "StatefulSet"}, StatefulSetHealth)
+	h.Register(schema.GroupKind{Group: "apps", Kind: "DaemonSet"}, DaemonSetHealth)
+	h.Register(schema.GroupKind{Group: "batch", Kind: "Job"}, JobHealth)
+	h.Register(schema.GroupKind{Group: "", Kind: "PersistentVolumeClaim"}, PersistentVolumeClaimHealth)
+	h.Register(schema.GroupKind{Group: "", Kind: "Service"}, ServiceHealth)
+	h.Register(schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}, CustomResourceDefinitionHealth)
+	return h
+}
+
+// Register sets the health check for a kind, replacing any existing check.
+func (h *HealthChecks) Register(kind schema.GroupKind, check HealthCheck) {
+	h.checks[kind] = check
+}
+
+// SetFallback sets the health check used for kinds without a registered check.
+func (h *HealthChecks) SetFallback(check HealthCheck) {
+	h.fallback = check
+}
+
+// Assess determines the health of a child resource.
+func (h *HealthChecks) Assess(obj *unstructured.Unstructured) (HealthStatus, string) {
+	check, ok := h.checks[obj.GroupVersionKind().GroupKind()]
+	if !ok {
+		check = h.fallback
+	}
+
+	if check == nil {
+		return HealthReady, ""
+	}
+
+	return check(obj)
+}
+
+// findCondition finds a condition of the given type in an object's status.
+func findCondition(obj *unstructured.Unstructured, conditionType string) (map[string]interface{}, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if t, _, _ := unstructured.NestedString(condition, "type"); t == conditionType {
+			return condition, true
+		}
+	}
+
+	return nil, false
+}
+
+// conditionStatus returns the status of the condition of the given type, if present.
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) (status, reason, message string) {
+	condition, ok := findCondition(obj, conditionType)
+	if !ok {
+		return "", "", ""
+	}
+
+	status, _, _ = unstructured.NestedString(condition, "status")
+	reason, _, _ = unstructured.NestedString(condition, "reason")
+	message, _, _ = unstructured.NestedString(condition, "message")
+	return
+}
+
+// isObserved returns false if the controller of an object has not yet
+// observed its latest generation.
+func isObserved(obj *unstructured.Unstructured) bool {
+	observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	return !found || observed >= obj.GetGeneration()
+}
+
+// specReplicas returns the desired replica count of an object, defaulting to 1.
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+
+	return replicas
+}
+
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	value, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return value
+}
+
+// ReadyConditionHealth assesses health from the generic Ready and Stalled
+// status conditions. Objects without a Ready condition are considered ready.
+func ReadyConditionHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if !isObserved(obj) {
+		return HealthProgressing, "waiting for latest generation to be observed"
+	}
+
+	if status, reason, message := conditionStatus(obj, "Stalled"); status == "True" {
+		return HealthDegraded, fmt.Sprintf("stalled: %s: %s", reason, message)
+	}
+
+	status, reason, message := conditionStatus(obj, "Ready")
+	switch status {
+	case "", "True":
+		return HealthReady, ""
+	default:
+		return HealthProgressing, fmt.Sprintf("not ready: %s: %s", reason, message)
+	}
+}
+
+// DeploymentHealth assesses the rollout of a Deployment.
+func DeploymentHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if !isObserved(obj) {
+		return HealthProgressing, "waiting for rollout to be observed"
+	}
+
+	if _, reason, message := conditionStatus(obj, "Progressing"); reason == "ProgressDeadlineExceeded" {
+		return HealthDegraded, message
+	}
+
+	replicas := specReplicas(obj)
+	updated := statusInt(obj, "updatedReplicas")
+	current := statusInt(obj, "replicas")
+	available := statusInt(obj, "availableReplicas")
+
+	switch {
+	case updated < replicas:
+		return HealthProgressing, fmt.Sprintf("%d of %d replicas updated", updated, replicas)
+	case current > updated:
+		return HealthProgressing, fmt.Sprintf("%d old replicas pending termination", current-updated)
+	case available < updated:
+		return HealthProgressing, fmt.Sprintf("%d of %d updated replicas available", available, updated)
+	}
+
+	return HealthReady, ""
+}
+
+// StatefulSetHealth assesses the rollout of a StatefulSet.
+func StatefulSetHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if !isObserved(obj) {
+		return HealthProgressing, "waiting for rollout to be observed"
+	}
+
+	replicas := specReplicas(obj)
+	ready := statusInt(obj, "readyReplicas")
+	if ready < replicas {
+		return HealthProgressing, fmt.Sprintf("%d of %d replicas ready", ready, replicas)
+	}
+
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return HealthReady, ""
+	}
+
+	if partition, found, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition"); found {
+		updated := statusInt(obj, "updatedReplicas")
+		if updated < replicas-partition {
+			return HealthProgressing, fmt.Sprintf("%d of %d replicas updated", updated, replicas-partition)
+		}
+
+		return HealthReady, ""
+	}
+
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if currentRevision != updateRevision {
+		return HealthProgressing, fmt.Sprintf("waiting for revision %s to roll out", updateRevision)
+	}
+
+	return HealthReady, ""
+}
+
+// DaemonSetHealth assesses the rollout of a DaemonSet.
+func DaemonSetHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if !isObserved(obj) {
+		return HealthProgressing, "waiting for rollout to be observed"
+	}
+
+	desired := statusInt(obj, "desiredNumberScheduled")
+	updated := statusInt(obj, "updatedNumberScheduled")
+	available := statusInt(obj, "numberAvailable")
+
+	switch {
+	case updated < desired:
+		return HealthProgressing, fmt.Sprintf("%d of %d pods updated", updated, desired)
+	case available < desired:
+		return HealthProgressing, fmt.Sprintf("%d of %d pods available", available, desired)
+	}
+
+	return HealthReady, ""
+}
+
+// JobHealth assesses the completion of a Job.
+func JobHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if status, reason, message := conditionStatus(obj, "Failed"); status == "True" {
+		return HealthDegraded, fmt.Sprintf("%s: %s", reason, message)
+	}
+
+	if status, _, _ := conditionStatus(obj, "Complete"); status == "True" {
+		return HealthReady, ""
+	}
+
+	return HealthProgressing, "waiting for job to complete"
+}
+
+// PersistentVolumeClaimHealth assesses whether a PersistentVolumeClaim is bound.
+func PersistentVolumeClaimHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Bound":
+		return HealthReady, ""
+	case "Lost":
+		return HealthDegraded, "claim has lost its volume"
+	default:
+		return HealthProgressing, "waiting for claim to be bound"
+	}
+}
+
+// ServiceHealth assesses whether a LoadBalancer Service has been assigned ingress.
+func ServiceHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return HealthReady, ""
+	}
+
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	if len(ingress) == 0 {
+		return HealthProgressing, "waiting for load balancer ingress"
+	}
+
+	return HealthReady, ""
+}
+
+// CustomResourceDefinitionHealth assesses whether a CustomResourceDefinition is established.
+func CustomResourceDefinitionHealth(obj *unstructured.Unstructured) (HealthStatus, string) {
+	if status, reason, message := conditionStatus(obj, "NamesAccepted"); status == "False" {
+		return HealthDegraded, fmt.Sprintf("%s: %s", reason, message)
+	}
+
+	if status, _, _ := conditionStatus(obj, "Established"); status == "True" {
+		return HealthReady, ""
+	}
+
+	return HealthProgressing, "waiting for definition to be established"
+}
@@ -0,0 +1,219 @@
+package composite
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func makeUnstructured(apiVersion, kind string, spec, status map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":       "test",
+			"generation": int64(2),
+		},
+	}}
+
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+
+	if status != nil {
+		obj.Object["status"] = status
+	}
+
+	return obj
+}
+
+func condition(conditionType, status, reason string) interface{} {
+	return map[string]interface{}{
+		"type":    conditionType,
+		"status":  status,
+		"reason":  reason,
+		"message": "test message",
+	}
+}
+
+var _ = Describe("HealthChecks", func() {
+	checks := DefaultHealthChecks()
+
+	It("should treat objects without status as ready", func() {
+		obj := makeUnstructured("v1", "ConfigMap", nil, nil)
+		status, _ := checks.Assess(obj)
+		Expect(status).To(Equal(HealthReady))
+	})
+
+	It("should use registered checks", func() {
+		custom := NewHealthChecks()
+		custom.Register(schema.GroupKind{Group: "", Kind: "ConfigMap"}, func(*unstructured.Unstructured) (HealthStatus, string) {
+			return HealthDegraded, "always broken"
+		})
+
+		status, reason := custom.Assess(makeUnstructured("v1", "ConfigMap", nil, nil))
+		Expect(status).To(Equal(HealthDegraded))
+		Expect(reason).To(Equal("always broken"))
+	})
+
+	Context("Deployment", func() {
+		It("should be progressing until observed", func() {
+			obj := makeUnstructured("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(1),
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+
+		It("should be progressing until replicas are available", func() {
+			obj := makeUnstructured("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2),
+				"replicas":           int64(2),
+				"updatedReplicas":    int64(2),
+				"availableReplicas":  int64(1),
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+
+		It("should be degraded if the progress deadline is exceeded", func() {
+			obj := makeUnstructured("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2),
+				"conditions": []interface{}{
+					condition("Progressing", "False", "ProgressDeadlineExceeded"),
+				},
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthDegraded))
+		})
+
+		It("should be ready once rolled out", func() {
+			obj := makeUnstructured("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2),
+				"replicas":           int64(2),
+				"updatedReplicas":    int64(2),
+				"availableReplicas":  int64(2),
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthReady))
+		})
+	})
+
+	Context("StatefulSet", func() {
+		It("should be progressing until the update revision is rolled out", func() {
+			obj := makeUnstructured("apps/v1", "StatefulSet", map[string]interface{}{"replicas": int64(1)}, map[string]interface{}{
+				"observedGeneration": int64(2),
+				"readyReplicas":      int64(1),
+				"currentRevision":    "a",
+				"updateRevision":     "b",
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+
+		It("should be ready once rolled out", func() {
+			obj := makeUnstructured("apps/v1", "StatefulSet", map[string]interface{}{"replicas": int64(1)}, map[string]interface{}{
+				"observedGeneration": int64(2),
+				"readyReplicas":      int64(1),
+				"currentRevision":    "b",
+				"updateRevision":     "b",
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthReady))
+		})
+	})
+
+	Context("DaemonSet", func() {
+		It("should be progressing until pods are available", func() {
+			obj := makeUnstructured("apps/v1", "DaemonSet", nil, map[string]interface{}{
+				"observedGeneration":     int64(2),
+				"desiredNumberScheduled": int64(3),
+				"updatedNumberScheduled": int64(3),
+				"numberAvailable":        int64(2),
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+	})
+
+	Context("Job", func() {
+		It("should be ready once complete", func() {
+			obj := makeUnstructured("batch/v1", "Job", nil, map[string]interface{}{
+				"conditions": []interface{}{condition("Complete", "True", "")},
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthReady))
+		})
+
+		It("should be degraded once failed", func() {
+			obj := makeUnstructured("batch/v1", "Job", nil, map[string]interface{}{
+				"conditions": []interface{}{condition("Failed", "True", "BackoffLimitExceeded")},
+			})
+			status, reason := checks.Assess(obj)
+			Expect(status).To(Equal(HealthDegraded))
+			Expect(reason).To(ContainSubstring("BackoffLimitExceeded"))
+		})
+	})
+
+	Context("PersistentVolumeClaim", func() {
+		It("should be progressing until bound", func() {
+			obj := makeUnstructured("v1", "PersistentVolumeClaim", nil, map[string]interface{}{"phase": "Pending"})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+	})
+
+	Context("Service", func() {
+		It("should be ready for cluster IP services", func() {
+			obj := makeUnstructured("v1", "Service", map[string]interface{}{"type": "ClusterIP"}, nil)
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthReady))
+		})
+
+		It("should be progressing until a load balancer has ingress", func() {
+			obj := makeUnstructured("v1", "Service", map[string]interface{}{"type": "LoadBalancer"}, nil)
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+	})
+
+	Context("CustomResourceDefinition", func() {
+		It("should be ready once established", func() {
+			obj := makeUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition", nil, map[string]interface{}{
+				"conditions": []interface{}{condition("Established", "True", "")},
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthReady))
+		})
+	})
+
+	Context("generic resources", func() {
+		It("should be progressing whilst not ready", func() {
+			obj := makeUnstructured("example.com/v1", "Widget", nil, map[string]interface{}{
+				"conditions": []interface{}{condition("Ready", "False", "Waiting")},
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthProgressing))
+		})
+
+		It("should be degraded when stalled", func() {
+			obj := makeUnstructured("example.com/v1", "Widget", nil, map[string]interface{}{
+				"conditions": []interface{}{condition("Stalled", "True", "Broken")},
+			})
+			status, _ := checks.Assess(obj)
+			Expect(status).To(Equal(HealthDegraded))
+		})
+	})
+})
+
+var _ = Describe("Health", func() {
+	It("should aggregate the worst status", func() {
+		health := Health{Status: HealthReady}
+		health.add(ChildHealth{Status: HealthReady})
+		health.add(ChildHealth{Status: HealthDegraded})
+		health.add(ChildHealth{Status: HealthProgressing})
+		Expect(health.Status).To(Equal(HealthDegraded))
+		Expect(health.Children).To(HaveLen(3))
+	})
+})
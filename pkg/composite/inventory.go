@@ -0,0 +1,199 @@
+package composite
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InventoryEntry records a single applied child.
+type InventoryEntry struct {
+	ChildReference
+	// ResourceVersion is the resource version of the child when it was last
+	// applied. It is not updated for changes which leave the generation of a
+	// child alone, such as status updates.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Generation is the generation of the child when it was last applied, if it has one.
+	Generation int64 `json:"generation,omitempty"`
+	// Hash is a hash of the desired state of the child when it was last
+	// applied, if unchanged children are skipped.
+	Hash string `json:"hash,omitempty"`
+	// AppliedAt is when the child was last applied, if unchanged children are skipped.
+	AppliedAt *metav1.Time `json:"appliedAt,omitempty"`
+}
+
+// inventoryEntryFor creates an inventory entry for a child. The child's GVK must be set.
+func inventoryEntryFor(obj client.Object) InventoryEntry {
+	return InventoryEntry{
+		ChildReference:  referenceTo(obj),
+		ResourceVersion: obj.GetResourceVersion(),
+		Generation:      obj.GetGeneration(),
+	}
+}
+
+// changedSince returns true if a child has changed since it was recorded in
+// an entry. The generation is compared if the child has one, so that status
+// updates are not counted as changes.
+func (e InventoryEntry) changedSince(previous InventoryEntry) bool {
+	if e.UID != previous.UID {
+		return true
+	}
+
+	if e.Generation != 0 || previous.Generation != 0 {
+		return e.Generation != previous.Generation
+	}
+
+	return e.ResourceVersion != previous.ResourceVersion
+}
+
+// equal returns true if two entries record the same state of a child, so
+// that the state needn't be saved. Resource versions are only compared for
+// children without a generation, so that status updates don't cause writes.
+func (e InventoryEntry) equal(other InventoryEntry) bool {
+	if e.ChildReference != other.ChildReference || e.Hash != other.Hash || e.changedSince(other) {
+		return false
+	}
+
+	return (e.AppliedAt == nil) == (other.AppliedAt == nil) &&
+		(e.AppliedAt == nil || e.AppliedAt.Equal(other.AppliedAt))
+}
+
+// sameChild returns true if two references refer to the same child, ignoring
+// the version of its kind and its UID.
+func sameChild(a, b ChildReference) bool {
+	return a.GroupVersionKind.GroupKind() == b.GroupVersionKind.GroupKind() &&
+		a.Namespace == b.Namespace &&
+		a.Name == b.Name
+}
+
+// inventoryIndex returns the index of a child in an inventory, or -1.
+func inventoryIndex(inventory []InventoryEntry, ref ChildReference) int {
+	for idx, e := range inventory {
+		if sameChild(e.ChildReference, ref) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// withoutChildren returns the entries of an inventory which don't refer to any
+// of the given children.
+func withoutChildren(inventory []InventoryEntry, refs []ChildReference) []InventoryEntry {
+	var kept []InventoryEntry
+	for _, entry := range inventory {
+		removed := false
+		for _, ref := range refs {
+			if sameChild(entry.ChildReference, ref) {
+				removed = true
+				break
+			}
+		}
+
+		if !removed {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
+
+// EnsureInventory makes sure the given children are included in the
+// inventory and returns true if any changes were made.
+func (s *State) EnsureInventory(entries []InventoryEntry) bool {
+	madeChanges := false
+
+	for _, entry := range entries {
+		idx := inventoryIndex(s.Inventory, entry.ChildReference)
+		if idx < 0 {
+			madeChanges = true
+			s.Inventory = append(s.Inventory, entry)
+			continue
+		}
+
+		if !s.Inventory[idx].equal(entry) {
+			madeChanges = true
+			s.Inventory[idx] = entry
+		}
+	}
+
+	return madeChanges
+}
+
+// sameInventory returns true if two inventories contain the same children.
+func sameInventory(a, b []InventoryEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, entry := range a {
+		idx := inventoryIndex(b, entry.ChildReference)
+		if idx < 0 || !b[idx].equal(entry) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Inventory returns every child recorded in the composite state of the parent.
+func (r *Reconciler) Inventory(ctx context.Context) ([]InventoryEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.refreshParent(ctx); err != nil {
+		return nil, err
+	}
+
+	state, err := r.peekState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Inventory, nil
+}
+
+// recordInventory adds all asserted children to the inventory.
+func (r *Reconciler) recordInventory(ctx context.Context, state *State, asserted []InventoryEntry) error {
+	if !state.EnsureInventory(asserted) {
+		return nil
+	}
+
+	return r.saveState(ctx, state)
+}
+
+// listInventory fetches the metadata of every child in the inventory which
+// still exists, except those with the given UIDs. Children are found even if
+// they are no longer labelled with the parent.
+func (r *Reconciler) listInventory(ctx context.Context, inventory []InventoryEntry, except []types.UID) ([]*metav1.PartialObjectMetadata, error) {
+	var children []*metav1.PartialObjectMetadata
+
+	for _, ref := range inventory {
+		if ref.UID == "" || hasUID(except, ref.UID) {
+			continue
+		}
+
+		child := &metav1.PartialObjectMetadata{}
+		child.SetGroupVersionKind(ref.GroupVersionKind)
+
+		key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+		if err := r.client.Get(ctx, key, child); apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		// An object with a different UID has replaced the child.
+		if child.GetUID() != ref.UID {
+			continue
+		}
+
+		child.SetGroupVersionKind(ref.GroupVersionKind)
+		children = append(children, child)
+	}
+
+	return children, nil
+}
@@ -0,0 +1,118 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Inventory", func() {
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	ref := func(name string, uid types.UID) InventoryEntry {
+		return InventoryEntry{
+			ChildReference: ChildReference{GroupVersionKind: configMap, Namespace: "default", Name: name, UID: uid},
+		}
+	}
+
+	Context("EnsureInventory", func() {
+		It("should add new children and update replaced ones", func() {
+			state := &State{Inventory: []InventoryEntry{ref("a", "1"), ref("b", "2")}}
+
+			Expect(state.EnsureInventory([]InventoryEntry{ref("a", "1")})).To(BeFalse())
+			Expect(state.EnsureInventory([]InventoryEntry{ref("b", "3"), ref("c", "4")})).To(BeTrue())
+			Expect(state.Inventory).To(Equal([]InventoryEntry{ref("a", "1"), ref("b", "3"), ref("c", "4")}))
+		})
+	})
+
+	Context("changedSince", func() {
+		It("should compare generations if set", func() {
+			previous := ref("a", "1")
+			previous.ResourceVersion = "1"
+			previous.Generation = 1
+
+			current := previous
+			current.ResourceVersion = "2"
+			Expect(current.changedSince(previous)).To(BeFalse())
+
+			current.Generation = 2
+			Expect(current.changedSince(previous)).To(BeTrue())
+		})
+
+		It("should compare resource versions without generations", func() {
+			previous := ref("a", "1")
+			previous.ResourceVersion = "1"
+
+			current := previous
+			Expect(current.changedSince(previous)).To(BeFalse())
+
+			current.ResourceVersion = "2"
+			Expect(current.changedSince(previous)).To(BeTrue())
+		})
+
+		It("should treat replaced children as changed", func() {
+			Expect(ref("a", "2").changedSince(ref("a", "1"))).To(BeTrue())
+		})
+	})
+
+	Context("sameInventory", func() {
+		It("should ignore order", func() {
+			Expect(sameInventory(
+				[]InventoryEntry{ref("a", "1"), ref("b", "2")},
+				[]InventoryEntry{ref("b", "2"), ref("a", "1")},
+			)).To(BeTrue())
+		})
+
+		It("should compare UIDs", func() {
+			Expect(sameInventory([]InventoryEntry{ref("a", "1")}, []InventoryEntry{ref("a", "2")})).To(BeFalse())
+		})
+
+		It("should ignore status updates", func() {
+			previous := ref("a", "1")
+			previous.ResourceVersion = "1"
+			previous.Generation = 1
+
+			current := previous
+			current.ResourceVersion = "2"
+			Expect(sameInventory([]InventoryEntry{previous}, []InventoryEntry{current})).To(BeTrue())
+
+			current.Generation = 2
+			Expect(sameInventory([]InventoryEntry{previous}, []InventoryEntry{current})).To(BeFalse())
+
+			By("comparing resource versions without generations")
+
+			previous.Generation, current.Generation = 0, 0
+			Expect(sameInventory([]InventoryEntry{previous}, []InventoryEntry{current})).To(BeFalse())
+		})
+	})
+
+	Context("listInventory", func() {
+		It("should find existing children with the same UID", func() {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "unlabelled", UID: "1"}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "replaced", UID: "5"}},
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "asserted", UID: "3"}},
+			).Build()
+			r := &Reconciler{logger: logr.Discard(), client: c}
+
+			children, err := r.listInventory(context.Background(), []InventoryEntry{
+				ref("unlabelled", "1"),
+				ref("replaced", "2"),
+				ref("asserted", "3"),
+				ref("missing", "4"),
+			}, []types.UID{"3"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(children).To(HaveLen(1))
+			Expect(children[0].GetName()).To(Equal("unlabelled"))
+			Expect(children[0].GroupVersionKind()).To(Equal(configMap))
+		})
+	})
+})
@@ -0,0 +1,124 @@
+package composite
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// resolveKinds makes sure every kind in the state is still served. Kinds
+// whose version is no longer served are moved to the preferred version of
+// the same group and kind. Kinds which are no longer served at all are
+// removed from the state, along with their inventory, and returned.
+// changed is true if the state was modified.
+func (r *Reconciler) resolveKinds(state *State) (removed []schema.GroupVersionKind, changed bool, err error) {
+	resolved := map[schema.GroupKind]schema.GroupVersionKind{}
+
+	resolve := func(gvk schema.GroupVersionKind) (schema.GroupVersionKind, bool, error) {
+		gk := gvk.GroupKind()
+		if served, ok := resolved[gk]; ok {
+			return served, served.Version != "", nil
+		}
+
+		served, err := r.servedKind(gvk)
+		if err != nil {
+			return gvk, false, err
+		}
+
+		resolved[gk] = served
+		return served, served.Version != "", nil
+	}
+
+	var kinds []schema.GroupVersionKind
+	for _, gvk := range state.DeployedKinds {
+		served, ok, err := resolve(gvk)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !ok {
+			r.logger.Info("kind is no longer served, not pruning children", "group", gvk.Group, "kind", gvk.Kind)
+			removed = append(removed, gvk)
+			changed = true
+			continue
+		}
+
+		if served != gvk {
+			r.logger.Info("version is no longer served, using preferred version", "group", gvk.Group, "kind", gvk.Kind, "from", gvk.Version, "to", served.Version)
+			changed = true
+		}
+
+		kinds = append(kinds, served)
+	}
+
+	var inventory []InventoryEntry
+	for _, ref := range state.Inventory {
+		served, ok, err := resolve(ref.GroupVersionKind)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !ok {
+			changed = true
+			continue
+		}
+
+		if served != ref.GroupVersionKind {
+			ref.GroupVersionKind = served
+			changed = true
+		}
+
+		inventory = append(inventory, ref)
+	}
+
+	if changed {
+		state.DeployedKinds = kinds
+		state.Inventory = inventory
+	}
+
+	return removed, changed, nil
+}
+
+// servedKind returns the given kind if it is served, otherwise the preferred
+// version of the same group and kind. If neither is served, the kind is
+// returned without a version. Kinds without a version always use the
+// preferred version.
+func (r *Reconciler) servedKind(gvk schema.GroupVersionKind) (schema.GroupVersionKind, error) {
+	mapper := r.client.RESTMapper()
+
+	if gvk.Version != "" {
+		_, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err == nil {
+			return gvk, nil
+		} else if !meta.IsNoMatchError(err) {
+			return gvk, err
+		}
+	}
+
+	mapping, err := mapper.RESTMapping(gvk.GroupKind())
+	if meta.IsNoMatchError(err) {
+		return gvk.GroupKind().WithVersion(""), nil
+	} else if err != nil {
+		return gvk, err
+	}
+
+	return mapping.GroupVersionKind, nil
+}
+
+// resolveStateKinds resolves the kinds in the state, saving the state if it
+// changed and reporting any kinds which are no longer served.
+func (r *Reconciler) resolveStateKinds(ctx context.Context, state *State, result *ReconcileResult) error {
+	removed, changed, err := r.resolveKinds(state)
+	if err != nil {
+		return err
+	}
+
+	result.UnavailableKinds = append(result.UnavailableKinds, removed...)
+
+	if !changed {
+		return nil
+	}
+
+	return r.saveState(ctx, state)
+}
@@ -0,0 +1,72 @@
+package composite
+
+import (
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Kinds", func() {
+	ingressV1 := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+	ingressBeta := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	widget := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+	var r *Reconciler
+
+	BeforeEach(func() {
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{configMap.GroupVersion(), ingressV1.GroupVersion()})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+		mapper.Add(ingressV1, meta.RESTScopeNamespace)
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).Build()
+		r = &Reconciler{logger: logr.Discard(), client: c}
+	})
+
+	It("should leave served kinds alone", func() {
+		state := &State{DeployedKinds: []schema.GroupVersionKind{configMap, ingressV1}}
+
+		removed, changed, err := r.resolveKinds(state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		Expect(removed).To(BeEmpty())
+	})
+
+	It("should fall back to the preferred version", func() {
+		state := &State{
+			DeployedKinds: []schema.GroupVersionKind{ingressBeta},
+			Inventory: []InventoryEntry{
+				{ChildReference: ChildReference{GroupVersionKind: ingressBeta, Name: "a", UID: "1"}},
+			},
+		}
+
+		removed, changed, err := r.resolveKinds(state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(removed).To(BeEmpty())
+		Expect(state.DeployedKinds).To(Equal([]schema.GroupVersionKind{ingressV1}))
+		Expect(state.Inventory[0].GroupVersionKind).To(Equal(ingressV1))
+	})
+
+	It("should remove kinds which are no longer served", func() {
+		state := &State{
+			DeployedKinds: []schema.GroupVersionKind{widget, configMap},
+			Inventory: []InventoryEntry{
+				{ChildReference: ChildReference{GroupVersionKind: widget, Name: "a", UID: "1"}},
+				{ChildReference: ChildReference{GroupVersionKind: configMap, Name: "b", UID: "2"}},
+			},
+		}
+
+		removed, changed, err := r.resolveKinds(state)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(removed).To(Equal([]schema.GroupVersionKind{widget}))
+		Expect(state.DeployedKinds).To(Equal([]schema.GroupVersionKind{configMap}))
+		Expect(state.Inventory).To(HaveLen(1))
+		Expect(state.Inventory[0].Name).To(Equal("b"))
+	})
+})
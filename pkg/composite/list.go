@@ -0,0 +1,87 @@
+package composite
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// childNamespaces returns the namespaces the parent may have written
+// children to. If nil is returned, children may be in any namespace.
+func (r *Reconciler) childNamespaces(state *State) []string {
+	if len(r.pruneNamespaces) > 0 {
+		return r.pruneNamespaces
+	}
+
+	return state.Namespaces
+}
+
+// listChildren lists the metadata of all children of a kind which are
+// labelled with the parent, only looking in the given namespaces if the
+// kind is namespaced. If no namespaces are given, all namespaces are searched.
+func (r *Reconciler) listChildren(ctx context.Context, gvk schema.GroupVersionKind, namespaces []string) ([]*metav1.PartialObjectMetadata, error) {
+	key, value := r.membership()
+	selector := labels.SelectorFromSet(labels.Set{key: value})
+	match := client.MatchingLabelsSelector{Selector: selector}
+
+	mapping, err := r.client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var listOptions [][]client.ListOption
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace || len(namespaces) == 0 {
+		listOptions = [][]client.ListOption{{match}}
+	} else {
+		for _, ns := range namespaces {
+			listOptions = append(listOptions, []client.ListOption{match, client.InNamespace(ns)})
+		}
+	}
+
+	var children []*metav1.PartialObjectMetadata
+
+	for _, opts := range listOptions {
+		var list metav1.PartialObjectMetadataList
+		list.SetGroupVersionKind(gvk)
+
+		if err := r.client.List(ctx, &list, opts...); err != nil {
+			return nil, err
+		}
+
+		for idx := range list.Items {
+			child := &list.Items[idx]
+			child.SetGroupVersionKind(gvk)
+			children = append(children, child)
+		}
+	}
+
+	return children, nil
+}
+
+// namespacesOf returns the distinct namespaces of namespaced children.
+func namespacesOf(children []client.Object) []string {
+	var namespaces []string
+
+	for _, child := range children {
+		ns := child.GetNamespace()
+		if ns != "" && !hasString(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	return namespaces
+}
+
+func hasString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
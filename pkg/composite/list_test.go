@@ -0,0 +1,84 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("namespaces", func() {
+	It("should list distinct namespaces of namespaced children", func() {
+		children := []client.Object{
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "one"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "two"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "two"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "one"}},
+		}
+
+		Expect(namespacesOf(children)).To(Equal([]string{"one", "two"}))
+	})
+
+	It("should record new namespaces in the state", func() {
+		state := State{Namespaces: []string{"one"}}
+		Expect(state.EnsureNamespaces([]string{"one"})).To(BeFalse())
+		Expect(state.EnsureNamespaces([]string{"two", "one"})).To(BeTrue())
+		Expect(state.Namespaces).To(Equal([]string{"one", "two"}))
+	})
+
+	It("should prefer explicitly configured namespaces", func() {
+		state := &State{Namespaces: []string{"one"}}
+
+		r := &Reconciler{}
+		Expect(r.childNamespaces(state)).To(Equal([]string{"one"}))
+
+		r.pruneNamespaces = []string{"two"}
+		Expect(r.childNamespaces(state)).To(Equal([]string{"two"}))
+	})
+
+	It("should prune children in any namespace for state without namespaces", func() {
+		ctx := context.Background()
+		configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent", UID: "parent-uid"}}
+		Expect(AccessState(parent).SetCompositeState(&State{
+			DeployedKinds: []schema.GroupVersionKind{configMap},
+		})).To(Succeed())
+
+		stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "old",
+			Name:      "stale",
+			UID:       "stale-uid",
+			Labels:    map[string]string{ParentLabel: "parent-uid"},
+		}}
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+
+		c := &immutableClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(parent, stale).Build()}
+		r, err := New(logr.Discard(), c, scheme.Scheme, parent, "test")
+		Expect(err).ToNot(HaveOccurred())
+
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child"}}
+		result, err := r.Reconcile(ctx, []client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Pruned).To(HaveLen(1))
+		Expect(result.Pruned[0].Name).To(Equal("stale"))
+
+		err = c.Get(ctx, client.ObjectKeyFromObject(stale), &corev1.ConfigMap{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		state, err := r.loadState(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Namespaces).To(Equal([]string{"default"}))
+	})
+})
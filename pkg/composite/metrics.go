@@ -0,0 +1,227 @@
+package composite
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "tiny_operator"
+	metricsSubsystem = "composite"
+)
+
+var (
+	gvkLabels       = []string{"group", "version", "kind"}
+	parentKindLabel = []string{"parent_group", "parent_kind"}
+
+	appliesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "applies_total",
+		Help:      "Total number of children applied which were created or changed.",
+	}, gvkLabels)
+
+	noopAppliesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "noop_applies_total",
+		Help:      "Total number of children applied which did not change.",
+	}, gvkLabels)
+
+	skippedAppliesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "skipped_applies_total",
+		Help:      "Total number of children which were not applied because they were unchanged.",
+	}, gvkLabels)
+
+	recreatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "recreates_total",
+		Help:      "Total number of children deleted and applied again because immutable fields changed.",
+	}, gvkLabels)
+
+	prunesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "prunes_total",
+		Help:      "Total number of children deleted or orphaned by pruning.",
+	}, gvkLabels)
+
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "errors_total",
+		Help:      "Total number of errors applying or pruning children.",
+	}, append([]string{"operation"}, gvkLabels...))
+
+	driftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "drift_total",
+		Help:      "Total number of children found to have been modified out of band.",
+	}, gvkLabels)
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of reconciling the children of a parent.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, parentKindLabel)
+
+	applyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "apply_duration_seconds",
+		Help:      "Duration of applying a single child.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+	}, gvkLabels)
+
+	pruneDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "prune_duration_seconds",
+		Help:      "Duration of pruning a single child.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+	}, gvkLabels)
+
+	childrenGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "children",
+		Help:      "Number of children of all parents of a kind.",
+	}, parentKindLabel)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		appliesTotal,
+		noopAppliesTotal,
+		skippedAppliesTotal,
+		recreatesTotal,
+		prunesTotal,
+		errorsTotal,
+		driftTotal,
+		reconcileDuration,
+		applyDuration,
+		pruneDuration,
+		childrenGauge,
+	)
+}
+
+func gvkValues(gvk schema.GroupVersionKind) []string {
+	return []string{gvk.Group, gvk.Version, gvk.Kind}
+}
+
+func parentKindValues(gk schema.GroupKind) []string {
+	return []string{gk.Group, gk.Kind}
+}
+
+// observeApply records the outcome of applying a child.
+func observeApply(gvk schema.GroupVersionKind, out childOutcome, changed bool, duration time.Duration) {
+	applyDuration.WithLabelValues(gvkValues(gvk)...).Observe(duration.Seconds())
+
+	if out.recreated != nil {
+		recreatesTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+	}
+
+	switch {
+	case out.err != nil:
+		errorsTotal.WithLabelValues(append([]string{"apply"}, gvkValues(gvk)...)...).Inc()
+	case out.unchanged:
+		skippedAppliesTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+	case !out.applied:
+	case changed:
+		appliesTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+	default:
+		noopAppliesTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+	}
+}
+
+// observePrune records the outcome of pruning a child.
+func observePrune(gvk schema.GroupVersionKind, pruned bool, err error, duration time.Duration) {
+	pruneDuration.WithLabelValues(gvkValues(gvk)...).Observe(duration.Seconds())
+
+	if err != nil {
+		errorsTotal.WithLabelValues(append([]string{"prune"}, gvkValues(gvk)...)...).Inc()
+	} else if pruned {
+		prunesTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+	}
+}
+
+// observeDrift records a child which was found to have drifted.
+func observeDrift(gvk schema.GroupVersionKind) {
+	driftTotal.WithLabelValues(gvkValues(gvk)...).Inc()
+}
+
+// countChildren records the number of children of the parent after a
+// successful reconcile.
+func (r *Reconciler) countChildren(count int) {
+	gk := r.parentGVK.GroupKind()
+	key := client.ObjectKeyFromObject(r.parent)
+	if r.parentMeta.GetDeletionTimestamp() != nil {
+		parentChildCounts.forget(gk, key)
+		return
+	}
+
+	parentChildCounts.set(gk, key, count)
+}
+
+// ForgetParent stops counting the children of a parent of the given kind in
+// the children metric. Parents are forgotten when they are torn down or
+// finalized, but parents deleted without a finalizer are not, so it should be
+// called when a reconciled parent is not found.
+func ForgetParent(gk schema.GroupKind, key types.NamespacedName) {
+	parentChildCounts.forget(gk, key)
+}
+
+// childCounts tracks the number of children of each parent, so that the
+// children gauge can be summed by parent kind. Parents are tracked by name,
+// since that is all that is known of parents which are not found.
+type childCounts struct {
+	mu     sync.Mutex
+	counts map[schema.GroupKind]map[types.NamespacedName]int
+}
+
+var parentChildCounts = &childCounts{counts: map[schema.GroupKind]map[types.NamespacedName]int{}}
+
+// set records the number of children of a parent.
+func (c *childCounts) set(gk schema.GroupKind, key types.NamespacedName, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parents, ok := c.counts[gk]
+	if !ok {
+		parents = map[types.NamespacedName]int{}
+		c.counts[gk] = parents
+	}
+
+	parents[key] = count
+	c.update(gk)
+}
+
+// forget stops counting the children of a parent.
+func (c *childCounts) forget(gk schema.GroupKind, key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.counts[gk], key)
+	c.update(gk)
+}
+
+func (c *childCounts) update(gk schema.GroupKind) {
+	total := 0
+	for _, count := range c.counts[gk] {
+		total += count
+	}
+
+	childrenGauge.WithLabelValues(parentKindValues(gk)...).Set(float64(total))
+}
@@ -0,0 +1,65 @@
+package composite
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Metrics", func() {
+	gvk := schema.GroupVersionKind{Group: "metrics.example.com", Version: "v1", Kind: "Widget"}
+	parent := schema.GroupKind{Group: "metrics.example.com", Kind: "Parent"}
+
+	It("should count applies by outcome", func() {
+		applies := testutil.ToFloat64(appliesTotal.WithLabelValues(gvkValues(gvk)...))
+		noops := testutil.ToFloat64(noopAppliesTotal.WithLabelValues(gvkValues(gvk)...))
+		skips := testutil.ToFloat64(skippedAppliesTotal.WithLabelValues(gvkValues(gvk)...))
+		errs := testutil.ToFloat64(errorsTotal.WithLabelValues("apply", gvk.Group, gvk.Version, gvk.Kind))
+
+		observeApply(gvk, childOutcome{applied: true}, true, time.Millisecond)
+		observeApply(gvk, childOutcome{unchanged: true}, false, time.Millisecond)
+		observeApply(gvk, childOutcome{applied: true}, false, time.Millisecond)
+		observeApply(gvk, childOutcome{err: errors.New("failed")}, false, time.Millisecond)
+		observeApply(gvk, childOutcome{skipped: true}, false, time.Millisecond)
+
+		Expect(testutil.ToFloat64(appliesTotal.WithLabelValues(gvkValues(gvk)...))).To(Equal(applies + 1))
+		Expect(testutil.ToFloat64(noopAppliesTotal.WithLabelValues(gvkValues(gvk)...))).To(Equal(noops + 1))
+		Expect(testutil.ToFloat64(skippedAppliesTotal.WithLabelValues(gvkValues(gvk)...))).To(Equal(skips + 1))
+		Expect(testutil.ToFloat64(errorsTotal.WithLabelValues("apply", gvk.Group, gvk.Version, gvk.Kind))).To(Equal(errs + 1))
+	})
+
+	It("should count prunes and errors", func() {
+		prunes := testutil.ToFloat64(prunesTotal.WithLabelValues(gvkValues(gvk)...))
+		errs := testutil.ToFloat64(errorsTotal.WithLabelValues("prune", gvk.Group, gvk.Version, gvk.Kind))
+
+		observePrune(gvk, true, nil, time.Millisecond)
+		observePrune(gvk, false, nil, time.Millisecond)
+		observePrune(gvk, false, errors.New("failed"), time.Millisecond)
+
+		Expect(testutil.ToFloat64(prunesTotal.WithLabelValues(gvkValues(gvk)...))).To(Equal(prunes + 1))
+		Expect(testutil.ToFloat64(errorsTotal.WithLabelValues("prune", gvk.Group, gvk.Version, gvk.Kind))).To(Equal(errs + 1))
+	})
+
+	It("should sum children of all parents of a kind", func() {
+		gauge := childrenGauge.WithLabelValues(parentKindValues(parent)...)
+
+		a := types.NamespacedName{Namespace: "default", Name: "a"}
+		b := types.NamespacedName{Namespace: "default", Name: "b"}
+
+		parentChildCounts.set(parent, a, 3)
+		parentChildCounts.set(parent, b, 2)
+		Expect(testutil.ToFloat64(gauge)).To(Equal(5.0))
+
+		parentChildCounts.set(parent, a, 1)
+		Expect(testutil.ToFloat64(gauge)).To(Equal(3.0))
+
+		parentChildCounts.forget(parent, b)
+		ForgetParent(parent, a)
+		Expect(testutil.ToFloat64(gauge)).To(Equal(0.0))
+	})
+})
@@ -0,0 +1,41 @@
+package composite
+
+import "sync"
+
+// parallel calls fn for every index in [0, n), using at most the configured
+// number of concurrent workers. It returns once every call has returned.
+// Callers should store results by index and merge them afterwards, so that
+// results don't depend on the level of concurrency.
+func (r *Reconciler) parallel(n int, fn func(idx int)) {
+	workers := r.concurrency
+	if workers > n {
+		workers = n
+	}
+
+	if workers <= 1 {
+		for idx := 0; idx < n; idx++ {
+			fn(idx)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	indices := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				fn(idx)
+			}
+		}()
+	}
+
+	for idx := 0; idx < n; idx++ {
+		indices <- idx
+	}
+
+	close(indices)
+	wg.Wait()
+}
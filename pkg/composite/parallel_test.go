@@ -0,0 +1,47 @@
+package composite
+
+import (
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parallel", func() {
+	It("should call every index exactly once", func() {
+		for _, concurrency := range []int{0, 1, 4, 100} {
+			r := &Reconciler{concurrency: concurrency}
+			calls := make([]int32, 50)
+
+			r.parallel(len(calls), func(idx int) {
+				atomic.AddInt32(&calls[idx], 1)
+			})
+
+			for _, c := range calls {
+				Expect(c).To(Equal(int32(1)))
+			}
+		}
+	})
+
+	It("should bound the number of concurrent calls", func() {
+		r := &Reconciler{concurrency: 3}
+
+		var active, maxActive int32
+		r.parallel(20, func(int) {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		})
+
+		Expect(maxActive).To(BeNumerically("<=", 3))
+		Expect(maxActive).To(BeNumerically(">", 1))
+	})
+})
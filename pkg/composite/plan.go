@@ -0,0 +1,247 @@
+package composite
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tinyerrors "github.com/wellplayedgames/tiny-operator/pkg/errors"
+)
+
+var (
+	// namespaceKind is the kind of namespaces, which other children may be created in.
+	namespaceKind = schema.GroupKind{Kind: "Namespace"}
+	// definitionKind is the kind of custom resource definitions, which define
+	// the kinds of other children.
+	definitionKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+)
+
+// PlannedUpdate describes a child which would be updated, and how.
+type PlannedUpdate struct {
+	Child ChildReference
+	Diffs []FieldDiff
+}
+
+// Plan describes the changes a reconcile would make to the children of a composite.
+type Plan struct {
+	// Creates lists children which do not exist yet. Children in namespaces
+	// which would be created, and custom resources whose definitions would be
+	// created, are listed without being dry-run.
+	Creates []ChildReference
+	// Updates lists children which exist but would change.
+	Updates []PlannedUpdate
+	// Unchanged lists children which exist and would not change.
+	Unchanged []ChildReference
+	// Prunes lists existing children which would be deleted.
+	Prunes []ChildReference
+	// Orphans lists existing children which would be orphaned rather than
+	// deleted, because of their prune policy. Children which are never
+	// pruned are not listed.
+	Orphans []ChildReference
+	// UnavailableKinds lists kinds of children which are no longer served
+	// by the API server, so their children would not be pruned.
+	UnavailableKinds []schema.GroupVersionKind
+}
+
+// HasChanges returns true if reconciling would change anything.
+func (p *Plan) HasChanges() bool {
+	return len(p.Creates) > 0 || len(p.Updates) > 0 || len(p.Prunes) > 0 || len(p.Orphans) > 0
+}
+
+// Plan determines what Reconcile would do with the given children, using
+// server-side dry-run. Neither the children nor the parent are modified in
+// the cluster. Children are planned in wave order, with the same field
+// ownership options as Reconcile. If planning some children fails, the
+// partial plan is returned alongside the error.
+func (r *Reconciler) Plan(ctx context.Context, children []client.Object) (*Plan, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.refreshParent(ctx); err != nil {
+		return nil, err
+	}
+
+	children, err := r.transform(children)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := r.peekState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := r.labelChildren(children)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]int, len(children))
+	for idx, child := range children {
+		orders[idx] = r.waveOf(child.GetObjectKind().GroupVersionKind(), child)
+	}
+
+	plan := &Plan{}
+	applyOptions := []client.PatchOption{client.DryRunAll, client.FieldOwner(r.owner)}
+	if !r.noForce {
+		applyOptions = append(applyOptions, client.ForceOwnership)
+	}
+
+	var passError error
+	var desiredUIDs []types.UID
+
+	// Children in namespaces or of kinds which don't exist yet can't be
+	// dry-run, so they are planned as creates when their namespace or
+	// definition would be created.
+	creatingNamespaces := map[string]bool{}
+	creatingKinds := map[schema.GroupKind]bool{}
+
+	for _, w := range groupWaves(orders) {
+		for _, idx := range w.items {
+			child := children[idx]
+			gvk := child.GetObjectKind().GroupVersionKind()
+
+			if creatingKinds[gvk.GroupKind()] || (child.GetNamespace() != "" && creatingNamespaces[child.GetNamespace()]) {
+				plan.Creates = append(plan.Creates, referenceTo(child))
+				continue
+			}
+
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(gvk)
+
+			exists := true
+			if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); apierrors.IsNotFound(err) {
+				exists = false
+			} else if err != nil {
+				passError = tinyerrors.Append(passError, err)
+				continue
+			}
+
+			desired, err := toUnstructured(child.DeepCopyObject().(client.Object))
+			if err != nil {
+				return plan, &permanentError{err}
+			}
+
+			if err := r.client.Patch(ctx, desired, client.Apply, applyOptions...); err != nil {
+				if conflict := asConflictError(child, err); conflict != nil {
+					err = conflict
+				}
+
+				passError = tinyerrors.Append(passError, err)
+				continue
+			}
+
+			if !exists {
+				switch gvk.GroupKind() {
+				case namespaceKind:
+					creatingNamespaces[child.GetName()] = true
+				case definitionKind:
+					if gk, ok := definedKind(desired); ok {
+						creatingKinds[gk] = true
+					}
+				}
+
+				// Dry-run creates are given a UID which will never exist.
+				ref := referenceTo(desired)
+				ref.UID = ""
+				plan.Creates = append(plan.Creates, ref)
+				continue
+			}
+
+			desiredUIDs = append(desiredUIDs, live.GetUID())
+
+			diffs := diffObjects(live.Object, desired.Object)
+			if len(diffs) == 0 {
+				plan.Unchanged = append(plan.Unchanged, referenceTo(live))
+			} else {
+				plan.Updates = append(plan.Updates, PlannedUpdate{
+					Child: referenceTo(live),
+					Diffs: diffs,
+				})
+			}
+		}
+	}
+
+	// Existing children can't be told apart from stale ones if any failed.
+	if passError != nil {
+		return plan, passError
+	}
+
+	// Kinds are resolved without saving the state.
+	removed, _, err := r.resolveKinds(state)
+	if err != nil {
+		return plan, err
+	}
+	plan.UnavailableKinds = removed
+
+	// Nothing of a kind which doesn't exist yet can be pruned.
+	var existingKinds []schema.GroupVersionKind
+	for _, gvk := range kinds {
+		if !creatingKinds[gvk.GroupKind()] {
+			existingKinds = append(existingKinds, gvk)
+		}
+	}
+
+	err = r.planPrunes(ctx, state, existingKinds, desiredUIDs, plan)
+	return plan, err
+}
+
+// definedKind returns the kind defined by a custom resource definition.
+func definedKind(definition *unstructured.Unstructured) (schema.GroupKind, bool) {
+	group, _, _ := unstructured.NestedString(definition.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(definition.Object, "spec", "names", "kind")
+	return schema.GroupKind{Group: group, Kind: kind}, kind != ""
+}
+
+// planPrunes adds all labelled or inventoried children which are not desired
+// to the plan, according to their prune policy.
+func (r *Reconciler) planPrunes(ctx context.Context, state *State, kinds []schema.GroupVersionKind, desiredUIDs []types.UID, plan *Plan) error {
+	allKinds := append([]schema.GroupVersionKind{}, state.DeployedKinds...)
+	for _, gvk := range kinds {
+		if kindIndex(allKinds, gvk.GroupKind()) < 0 {
+			allKinds = append(allKinds, gvk)
+		}
+	}
+
+	var found []types.UID
+
+	add := func(child *metav1.PartialObjectMetadata) {
+		switch r.prunePolicyOf(child.GroupVersionKind(), child) {
+		case PruneNever:
+		case PruneOrphan:
+			plan.Orphans = append(plan.Orphans, referenceTo(child))
+		default:
+			plan.Prunes = append(plan.Prunes, referenceTo(child))
+		}
+	}
+
+	for _, gvk := range allKinds {
+		children, err := r.listChildren(ctx, gvk, r.childNamespaces(state))
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			found = append(found, child.GetUID())
+			if !hasUID(desiredUIDs, child.GetUID()) {
+				add(child)
+			}
+		}
+	}
+
+	unlabelled, err := r.listInventory(ctx, state.Inventory, append(found, desiredUIDs...))
+	if err != nil {
+		return err
+	}
+
+	for _, child := range unlabelled {
+		add(child)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// dryRunClient accepts dry-run applies without changing anything, since the
+// fake client can't apply.
+type dryRunClient struct {
+	client.Client
+}
+
+func (c *dryRunClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch == client.Apply {
+		return nil
+	}
+
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+var _ = Describe("Plan", func() {
+	It("should plan custom resources whose definitions would be created", func() {
+		definitionGVK := schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+		widgetGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+		definition := &unstructured.Unstructured{}
+		definition.SetGroupVersionKind(definitionGVK)
+		definition.SetName("widgets.example.com")
+		Expect(unstructured.SetNestedField(definition.Object, "example.com", "spec", "group")).To(Succeed())
+		Expect(unstructured.SetNestedField(definition.Object, "Widget", "spec", "names", "kind")).To(Succeed())
+
+		widget := &unstructured.Unstructured{}
+		widget.SetGroupVersionKind(widgetGVK)
+		widget.SetNamespace("default")
+		widget.SetName("widget")
+
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent", UID: "parent-uid"}}
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{definitionGVK.GroupVersion()})
+		mapper.Add(definitionGVK, meta.RESTScopeRoot)
+
+		c := &dryRunClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(parent).Build()}
+		r, err := New(logr.Discard(), c, scheme.Scheme, parent, "test")
+		Expect(err).ToNot(HaveOccurred())
+
+		// The custom resource comes first, but is planned after its definition.
+		plan, err := r.Plan(context.Background(), []client.Object{widget, definition})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plan.Creates).To(HaveLen(2))
+		Expect(plan.Creates[0].Name).To(Equal("widgets.example.com"))
+		Expect(plan.Creates[1].Name).To(Equal("widget"))
+	})
+})
+
+var _ = Describe("planPrunes", func() {
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	It("should plan prunes according to prune policies", func() {
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent", UID: "parent-uid"}}
+
+		objs := []client.Object{parent}
+		for _, policy := range []PrunePolicy{PruneDelete, PruneOrphan, PruneNever} {
+			objs = append(objs, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        string(policy),
+				UID:         types.UID(policy + "-uid"),
+				Labels:      map[string]string{ParentLabel: "parent-uid"},
+				Annotations: map[string]string{PrunePolicyAnnotation: string(policy)},
+			}})
+		}
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(objs...).Build()
+		r, err := New(logr.Discard(), c, scheme.Scheme, parent, "test")
+		Expect(err).ToNot(HaveOccurred())
+
+		state := &State{DeployedKinds: []schema.GroupVersionKind{configMap}, Namespaces: []string{"default"}}
+		plan := &Plan{}
+		Expect(r.planPrunes(context.Background(), state, nil, nil, plan)).To(Succeed())
+
+		Expect(plan.Prunes).To(HaveLen(1))
+		Expect(plan.Prunes[0].Name).To(Equal("delete"))
+		Expect(plan.Orphans).To(HaveLen(1))
+		Expect(plan.Orphans[0].Name).To(Equal("orphan"))
+		Expect(plan.HasChanges()).To(BeTrue())
+	})
+})
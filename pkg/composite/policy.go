@@ -0,0 +1,76 @@
+package composite
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PrunePolicyAnnotation is the key of the annotation used to set the prune policy of a child resource.
+	PrunePolicyAnnotation = "hive.wellplayed.games/prune-policy"
+)
+
+// PrunePolicy determines what happens to a child resource once it is no longer desired.
+type PrunePolicy string
+
+const (
+	// PruneDelete deletes the child. This is the default.
+	PruneDelete PrunePolicy = "delete"
+	// PruneOrphan disassociates the child from its parent, leaving it in place.
+	PruneOrphan PrunePolicy = "orphan"
+	// PruneNever leaves the child in place and still associated with its parent.
+	PruneNever PrunePolicy = "never"
+)
+
+// PrunePolicyFunc determines the prune policy of a child resource.
+// It should return false if it does not have an opinion on the child.
+type PrunePolicyFunc func(gvk schema.GroupVersionKind, obj metav1.Object) (PrunePolicy, bool)
+
+// prunePolicyOf determines the prune policy of a live child from, in order of
+// precedence, its prune policy annotation and the configured PrunePolicyFunc.
+func (r *Reconciler) prunePolicyOf(gvk schema.GroupVersionKind, obj metav1.Object) PrunePolicy {
+	if text, ok := obj.GetAnnotations()[PrunePolicyAnnotation]; ok {
+		switch policy := PrunePolicy(text); policy {
+		case PruneDelete, PruneOrphan, PruneNever:
+			return policy
+		default:
+			// Err on the side of keeping data which was meant to be protected.
+			r.logger.Info("treating invalid prune policy as never", "kind", gvk.Kind, "name", obj.GetName(), "policy", text)
+			return PruneNever
+		}
+	}
+
+	if r.prunePolicyFunc != nil {
+		if policy, ok := r.prunePolicyFunc(gvk, obj); ok {
+			return policy
+		}
+	}
+
+	return PruneDelete
+}
+
+// orphan disassociates a child from the parent by removing the parent and
+// ApplySet labels and any owner references to the parent.
+func (r *Reconciler) orphan(ctx context.Context, obj client.Object) error {
+	original := obj.DeepCopyObject().(client.Object)
+
+	childLabels := obj.GetLabels()
+	delete(childLabels, ParentLabel)
+	if r.applySetTooling != "" {
+		delete(childLabels, ApplySetPartOfLabel)
+	}
+	obj.SetLabels(childLabels)
+
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID != r.parentMeta.GetUID() {
+			refs = append(refs, ref)
+		}
+	}
+	obj.SetOwnerReferences(refs)
+
+	return r.client.Patch(ctx, obj, client.MergeFrom(original))
+}
@@ -0,0 +1,42 @@
+package composite
+
+import (
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("prunePolicyOf", func() {
+	var r *Reconciler
+	pvc := schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}
+
+	BeforeEach(func() {
+		r = &Reconciler{logger: logr.Discard()}
+	})
+
+	It("should delete by default", func() {
+		Expect(r.prunePolicyOf(pvc, &metav1.ObjectMeta{})).To(Equal(PruneDelete))
+	})
+
+	It("should use the prune policy annotation", func() {
+		obj := &metav1.ObjectMeta{Annotations: map[string]string{PrunePolicyAnnotation: "orphan"}}
+		Expect(r.prunePolicyOf(pvc, obj)).To(Equal(PruneOrphan))
+	})
+
+	It("should never prune with an invalid annotation", func() {
+		obj := &metav1.ObjectMeta{Annotations: map[string]string{PrunePolicyAnnotation: "sometimes"}}
+		Expect(r.prunePolicyOf(pvc, obj)).To(Equal(PruneNever))
+	})
+
+	It("should use the prune policy function", func() {
+		r.prunePolicyFunc = func(gvk schema.GroupVersionKind, _ metav1.Object) (PrunePolicy, bool) {
+			return PruneNever, gvk.Kind == "PersistentVolumeClaim"
+		}
+
+		Expect(r.prunePolicyOf(pvc, &metav1.ObjectMeta{})).To(Equal(PruneNever))
+		Expect(r.prunePolicyOf(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, &metav1.ObjectMeta{})).
+			To(Equal(PruneDelete))
+	})
+})
@@ -0,0 +1,140 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// RecreatePolicyAnnotation is the key of the annotation used to set the recreate policy of a child resource.
+	RecreatePolicyAnnotation = "hive.wellplayed.games/recreate-policy"
+)
+
+// RecreatePolicy determines what happens to a child resource when applying it
+// fails because an immutable field changed.
+type RecreatePolicy string
+
+const (
+	// RecreateNever fails to apply the child. This is the default.
+	RecreateNever RecreatePolicy = "never"
+	// RecreateDelete deletes the child, along with its dependents, and applies it again.
+	RecreateDelete RecreatePolicy = "delete"
+	// RecreateOrphan deletes the child, leaving its dependents in place, and applies it again.
+	RecreateOrphan RecreatePolicy = "orphan"
+)
+
+// RecreatePolicyFunc determines the recreate policy of a child resource.
+// It should return false if it does not have an opinion on the child.
+type RecreatePolicyFunc func(gvk schema.GroupVersionKind, obj metav1.Object) (RecreatePolicy, bool)
+
+// WithRecreatePolicyFunc sets a function used to determine the recreate policy
+// of children. The recreate policy annotation on a child always takes precedence.
+func WithRecreatePolicyFunc(fn RecreatePolicyFunc) Option {
+	return func(r *Reconciler) {
+		r.recreatePolicyFunc = fn
+	}
+}
+
+// immutableMessages are fragments of the messages of validation errors which
+// are caused by changing immutable fields.
+var immutableMessages = []string{
+	"field is immutable",
+	"spec is immutable",
+	"may not change once set",
+	"updates to statefulset spec for fields other than",
+}
+
+// isImmutableFieldError returns true if an apply was rejected because it
+// changed immutable fields.
+func isImmutableFieldError(err error) bool {
+	var status apierrors.APIStatus
+	if !apierrors.IsInvalid(err) || !errors.As(err, &status) {
+		return false
+	}
+
+	messages := []string{status.Status().Message}
+	if details := status.Status().Details; details != nil {
+		for _, cause := range details.Causes {
+			messages = append(messages, cause.Message)
+		}
+	}
+
+	for _, message := range messages {
+		for _, fragment := range immutableMessages {
+			if strings.Contains(message, fragment) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// recreatePolicyOf determines the recreate policy of a desired child from, in
+// order of precedence, its recreate policy annotation and the configured
+// RecreatePolicyFunc.
+func (r *Reconciler) recreatePolicyOf(gvk schema.GroupVersionKind, obj metav1.Object) RecreatePolicy {
+	if text, ok := obj.GetAnnotations()[RecreatePolicyAnnotation]; ok {
+		switch policy := RecreatePolicy(text); policy {
+		case RecreateNever, RecreateDelete, RecreateOrphan:
+			return policy
+		default:
+			// Err on the side of keeping children which were meant to be protected.
+			r.logger.Info("treating invalid recreate policy as never", "kind", gvk.Kind, "name", obj.GetName(), "policy", text)
+			return RecreateNever
+		}
+	}
+
+	if r.recreatePolicyFunc != nil {
+		if policy, ok := r.recreatePolicyFunc(gvk, obj); ok {
+			return policy
+		}
+	}
+
+	return RecreateNever
+}
+
+// recreate deletes a child whose immutable fields changed and applies it
+// again. If the child is still being deleted, a retriable error is returned
+// and the child is recreated by a later reconcile.
+// It must not modify the reconciler, so that children can be recreated concurrently.
+func (r *Reconciler) recreate(ctx context.Context, child client.Object, policy RecreatePolicy) error {
+	live := &metav1.PartialObjectMetadata{}
+	live.SetGroupVersionKind(child.GetObjectKind().GroupVersionKind())
+
+	err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		live.SetGroupVersionKind(child.GetObjectKind().GroupVersionKind())
+		if live.GetDeletionTimestamp() == nil {
+			propagation := metav1.DeletePropagationBackground
+			if policy == RecreateOrphan {
+				propagation = metav1.DeletePropagationOrphan
+			}
+
+			uid := live.GetUID()
+			err := r.client.Delete(ctx, live, client.Preconditions{UID: &uid}, client.PropagationPolicy(propagation))
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+
+		if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); err == nil {
+			return fmt.Errorf("waiting for %s to be removed before recreating it", referenceTo(child))
+		} else if !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return r.apply(ctx, child, !r.noForce)
+}
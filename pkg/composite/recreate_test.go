@@ -0,0 +1,133 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// immutableClient rejects applies to existing objects as if they changed
+// immutable fields, and creates objects which don't exist.
+type immutableClient struct {
+	client.Client
+}
+
+func (c *immutableClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	live := &metav1.PartialObjectMetadata{}
+	live.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), live); apierrors.IsNotFound(err) {
+		obj.SetUID("recreated-uid")
+		return c.Create(ctx, obj)
+	} else if err != nil {
+		return err
+	}
+
+	return immutableError(obj.GetName())
+}
+
+func immutableError(name string) error {
+	return apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, name, field.ErrorList{
+		field.Invalid(field.NewPath("data"), nil, "field is immutable when `immutable` is set"),
+	})
+}
+
+var _ = Describe("Recreate", func() {
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	var c client.Client
+	var r *Reconciler
+
+	desired := func(policy RecreatePolicy) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "child",
+			Annotations: map[string]string{RecreatePolicyAnnotation: string(policy)},
+		}}
+		cm.SetGroupVersionKind(configMap)
+		return cm
+	}
+
+	BeforeEach(func() {
+		live := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child", UID: "old-uid"}}
+		c = &immutableClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()}
+		r = &Reconciler{logger: logr.Discard(), client: c, owner: "test"}
+	})
+
+	It("should detect immutable field errors", func() {
+		Expect(isImmutableFieldError(immutableError("child"))).To(BeTrue())
+		Expect(isImmutableFieldError(apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, "child", field.ErrorList{
+			field.Invalid(field.NewPath("spec", "clusterIPs").Index(0), "10.0.0.1", "may not change once set"),
+		}))).To(BeTrue())
+
+		Expect(isImmutableFieldError(apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "child", field.ErrorList{
+			field.Required(field.NewPath("metadata", "name"), ""),
+		}))).To(BeFalse())
+		Expect(isImmutableFieldError(apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "child"))).To(BeFalse())
+	})
+
+	It("should never recreate by default", func() {
+		Expect(r.recreatePolicyOf(configMap, &metav1.ObjectMeta{})).To(Equal(RecreateNever))
+
+		out := r.applyChild(context.Background(), desired(RecreateNever))
+		Expect(isImmutableFieldError(out.err)).To(BeTrue())
+		Expect(out.recreated).To(BeNil())
+	})
+
+	It("should never recreate with an invalid annotation", func() {
+		obj := &metav1.ObjectMeta{Annotations: map[string]string{RecreatePolicyAnnotation: "sometimes"}}
+		Expect(r.recreatePolicyOf(configMap, obj)).To(Equal(RecreateNever))
+	})
+
+	It("should use the recreate policy function", func() {
+		r.recreatePolicyFunc = func(gvk schema.GroupVersionKind, _ metav1.Object) (RecreatePolicy, bool) {
+			return RecreateOrphan, gvk.Kind == "ConfigMap"
+		}
+
+		Expect(r.recreatePolicyOf(configMap, &metav1.ObjectMeta{})).To(Equal(RecreateOrphan))
+		Expect(r.recreatePolicyOf(configMap, desired(RecreateDelete))).To(Equal(RecreateDelete))
+	})
+
+	It("should delete and apply children again", func() {
+		child := desired(RecreateDelete)
+		out := r.applyChild(context.Background(), child)
+		Expect(out.err).ToNot(HaveOccurred())
+		Expect(out.applied).To(BeTrue())
+		Expect(isImmutableFieldError(out.recreated)).To(BeTrue())
+		Expect(out.entry.UID).To(BeEquivalentTo("recreated-uid"))
+
+		previous := []InventoryEntry{{ChildReference: ChildReference{
+			GroupVersionKind: configMap, Namespace: "default", Name: "child", UID: "old-uid",
+		}}}
+		reason := changeReason(previous, out)
+		Expect(reason).To(Equal(EventReasonRecreated))
+		Expect(outcomeOf(out, reason)).To(Equal(OutcomeRecreated))
+	})
+
+	It("should wait for children to be removed before applying them again", func() {
+		live := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "child"}, live)).To(Succeed())
+		live.Finalizers = []string{"example.com/finalizer"}
+		Expect(c.Update(context.Background(), live)).To(Succeed())
+
+		out := r.applyChild(context.Background(), desired(RecreateOrphan))
+		Expect(out.err).To(MatchError(ContainSubstring("waiting for ConfigMap default/child to be removed")))
+		Expect(out.recreated).To(BeNil())
+
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "child"}, live)).To(Succeed())
+		Expect(live.DeletionTimestamp).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,202 @@
+package composite
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChildReference identifies a single child resource.
+type ChildReference struct {
+	GroupVersionKind schema.GroupVersionKind `json:"gvk"`
+	Namespace        string                  `json:"namespace,omitempty"`
+	Name             string                  `json:"name"`
+	UID              types.UID               `json:"uid,omitempty"`
+}
+
+// String returns a human readable description of the child.
+func (c ChildReference) String() string {
+	if c.Namespace == "" {
+		return c.GroupVersionKind.Kind + " " + c.Name
+	}
+
+	return c.GroupVersionKind.Kind + " " + c.Namespace + "/" + c.Name
+}
+
+// referenceTo creates a reference to a child. The child's GVK must be set.
+func referenceTo(obj client.Object) ChildReference {
+	return ChildReference{
+		GroupVersionKind: obj.GetObjectKind().GroupVersionKind(),
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+		UID:              obj.GetUID(),
+	}
+}
+
+// ChildOutcome describes what happened to a single child.
+type ChildOutcome string
+
+const (
+	// OutcomeCreated means the child didn't exist and was created.
+	OutcomeCreated ChildOutcome = "created"
+	// OutcomeUpdated means the child was changed by applying it.
+	OutcomeUpdated ChildOutcome = "updated"
+	// OutcomeRecreated means the child was deleted and applied again,
+	// because immutable fields changed.
+	OutcomeRecreated ChildOutcome = "recreated"
+	// OutcomeUnchanged means the child was already up to date.
+	OutcomeUnchanged ChildOutcome = "unchanged"
+	// OutcomeSkipped means the child was deliberately left as it is, because
+	// it is controlled by another owner or applying it conflicted.
+	OutcomeSkipped ChildOutcome = "skipped"
+	// OutcomePruned means the child was deleted.
+	OutcomePruned ChildOutcome = "pruned"
+	// OutcomeOrphaned means the child was disassociated from the parent
+	// instead of being deleted.
+	OutcomeOrphaned ChildOutcome = "orphaned"
+	// OutcomeFailed means applying or pruning the child failed.
+	OutcomeFailed ChildOutcome = "failed"
+)
+
+// ChildResult describes the outcome of applying or pruning a single child.
+type ChildResult struct {
+	Child   ChildReference
+	Outcome ChildOutcome
+	// Err is set if the outcome is OutcomeFailed.
+	Err error
+}
+
+// ReconcileResult describes the outcome of reconciling a composite.
+type ReconcileResult struct {
+	// Health is the aggregated health of all children.
+	Health Health
+	// Children lists every child which was applied or pruned, with its
+	// outcome, in the order they were handled.
+	Children []ChildResult
+	// Adopted lists pre-existing resources which were adopted as children.
+	Adopted []ChildReference
+	// Skipped lists children which were not applied, because they are
+	// controlled by another owner or applying them conflicted.
+	Skipped []ChildReference
+	// Conflicts lists the conflicts which caused children to be skipped.
+	Conflicts []*ConflictError
+	// Pruned lists children which were deleted.
+	Pruned []ChildReference
+	// Orphaned lists children which were disassociated from the parent
+	// instead of being deleted.
+	Orphaned []ChildReference
+	// Recreated lists children which were deleted and applied again,
+	// because immutable fields changed.
+	Recreated []ChildReference
+	// UnavailableKinds lists kinds of children which are no longer served
+	// by the API server, so their children could not be pruned.
+	UnavailableKinds []schema.GroupVersionKind
+	// PendingDeletion lists children which have been deleted but still exist.
+	PendingDeletion []PendingDeletion
+	// Drift lists children which were modified out of band, if drift
+	// detection is enabled. They are corrected unless observing only.
+	Drift []DriftedChild
+	// RequeueAfter is the suggested delay before reconciling again, or zero
+	// if there is no need to requeue.
+	RequeueAfter time.Duration
+
+	// asserted collects the children asserted by the call which returned the
+	// result, so that they can be kept by Prune.
+	asserted assertion
+}
+
+// addChild records the outcome of a child.
+func (r *ReconcileResult) addChild(child ChildReference, outcome ChildOutcome, err error) {
+	r.Children = append(r.Children, ChildResult{Child: child, Outcome: outcome, Err: err})
+}
+
+// outcomeOf returns the outcome of a child which was asserted without error,
+// given the reason of the event recorded for it.
+func outcomeOf(out childOutcome, reason string) ChildOutcome {
+	switch {
+	case out.skipped:
+		return OutcomeSkipped
+	case reason == EventReasonRecreated:
+		return OutcomeRecreated
+	case reason == EventReasonCreated:
+		return OutcomeCreated
+	case reason == EventReasonUpdated, out.adopted:
+		return OutcomeUpdated
+	default:
+		return OutcomeUnchanged
+	}
+}
+
+// assertion collects the children asserted by a single call. Everything else
+// is pruned.
+type assertion struct {
+	uids       []types.UID
+	kinds      []schema.GroupVersionKind
+	namespaces []string
+	inventory  []InventoryEntry
+}
+
+// addKinds adds kinds, replacing the version of any kinds already added.
+func (a *assertion) addKinds(kinds []schema.GroupVersionKind) {
+	for _, gvk := range kinds {
+		idx := kindIndex(a.kinds, gvk.GroupKind())
+
+		if idx >= 0 {
+			a.kinds[idx] = gvk
+		} else {
+			a.kinds = append(a.kinds, gvk)
+		}
+	}
+}
+
+// addNamespaces adds namespaces which haven't been added yet.
+func (a *assertion) addNamespaces(namespaces []string) {
+	for _, ns := range namespaces {
+		if !hasString(a.namespaces, ns) {
+			a.namespaces = append(a.namespaces, ns)
+		}
+	}
+}
+
+// addEntry adds a child, replacing any entry for the same child.
+func (a *assertion) addEntry(entry InventoryEntry) {
+	if !hasUID(a.uids, entry.UID) {
+		a.uids = append(a.uids, entry.UID)
+	}
+
+	if idx := inventoryIndex(a.inventory, entry.ChildReference); idx >= 0 {
+		a.inventory[idx] = entry
+	} else {
+		a.inventory = append(a.inventory, entry)
+	}
+}
+
+// merge adds everything asserted by another call.
+func (a *assertion) merge(other *assertion) {
+	a.addKinds(other.kinds)
+	a.addNamespaces(other.namespaces)
+	for _, entry := range other.inventory {
+		a.addEntry(entry)
+	}
+}
+
+// toUnstructured converts a child to its unstructured representation.
+// Unstructured children are returned as-is.
+func toUnstructured(obj client.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: m}
+	u.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	return u, nil
+}
@@ -0,0 +1,160 @@
+package composite
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Result", func() {
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	var c client.Client
+	var r *Reconciler
+	var children []*corev1.ConfigMap
+
+	// assertedBy creates a result which asserted the given children.
+	assertedBy := func(asserted ...*corev1.ConfigMap) *ReconcileResult {
+		result := &ReconcileResult{}
+		result.asserted.addKinds([]schema.GroupVersionKind{configMap})
+		result.asserted.addNamespaces([]string{"default"})
+		for _, child := range asserted {
+			result.asserted.addEntry(inventoryEntryFor(child))
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent", UID: "parent-uid"}}
+		Expect(AccessState(parent).SetCompositeState(&State{
+			DeployedKinds: []schema.GroupVersionKind{configMap},
+			Namespaces:    []string{"default"},
+		})).To(Succeed())
+
+		children = nil
+		objs := []client.Object{parent}
+		for _, name := range []string{"a", "b", "c"} {
+			child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				UID:       types.UID(name + "-uid"),
+				Labels:    map[string]string{ParentLabel: "parent-uid"},
+			}}
+			children = append(children, child)
+			objs = append(objs, child)
+		}
+
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(configMap, meta.RESTScopeNamespace)
+
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(objs...).Build()
+		for _, child := range children {
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(child), child)).To(Succeed())
+			child.SetGroupVersionKind(configMap)
+		}
+
+		var err error
+		r, err = New(logr.Discard(), c, scheme.Scheme, parent, "test")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should describe the outcome of each child", func() {
+		created := childOutcome{applied: true}
+		Expect(outcomeOf(created, EventReasonCreated)).To(Equal(OutcomeCreated))
+		Expect(outcomeOf(created, EventReasonUpdated)).To(Equal(OutcomeUpdated))
+		Expect(outcomeOf(created, "")).To(Equal(OutcomeUnchanged))
+		Expect(outcomeOf(childOutcome{applied: true, adopted: true}, "")).To(Equal(OutcomeUpdated))
+		Expect(outcomeOf(childOutcome{unchanged: true}, "")).To(Equal(OutcomeUnchanged))
+		Expect(outcomeOf(childOutcome{skipped: true}, EventReasonCreated)).To(Equal(OutcomeSkipped))
+	})
+
+	It("should merge children asserted by several calls", func() {
+		merged := &assertion{}
+		merged.merge(&assertedBy(children[0]).asserted)
+		merged.merge(&assertedBy(children[0], children[1]).asserted)
+
+		Expect(merged.kinds).To(Equal([]schema.GroupVersionKind{configMap}))
+		Expect(merged.namespaces).To(Equal([]string{"default"}))
+		Expect(merged.uids).To(ConsistOf(children[0].UID, children[1].UID))
+		Expect(merged.inventory).To(HaveLen(2))
+	})
+
+	It("should only prune children which weren't asserted by any result", func() {
+		result, err := r.Prune(context.Background(), assertedBy(children[0]), assertedBy(children[1]))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Children).To(Equal([]ChildResult{
+			{Child: referenceTo(children[2]), Outcome: OutcomePruned},
+		}))
+
+		state, err := r.loadState(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(state.Inventory).To(HaveLen(2))
+
+		// Nothing is remembered between calls.
+		result, err = r.Prune(context.Background(), assertedBy(children[0]))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Children).To(Equal([]ChildResult{
+			{Child: referenceTo(children[1]), Outcome: OutcomePruned},
+		}))
+	})
+
+	It("should report failed reconciles as degraded", func() {
+		// The fake client can't apply children.
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "new"}}
+		result, err := r.Reconcile(context.Background(), []client.Object{child})
+		Expect(err).To(HaveOccurred())
+		Expect(result.Health.Status).To(Equal(HealthDegraded))
+	})
+
+	It("should fetch the parent again for each call", func() {
+		parent := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "parent"}, parent)).To(Succeed())
+		Expect(AccessState(parent).SetCompositeState(&State{
+			DeployedKinds: []schema.GroupVersionKind{configMap},
+			Namespaces:    []string{"default"},
+			Inventory:     []InventoryEntry{inventoryEntryFor(children[0])},
+		})).To(Succeed())
+		Expect(c.Update(context.Background(), parent)).To(Succeed())
+
+		inventory, err := r.Inventory(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inventory).To(HaveLen(1))
+		Expect(inventory[0].UID).To(Equal(children[0].UID))
+	})
+
+	It("should require an asserted result", func() {
+		_, err := r.Prune(context.Background(), nil)
+		Expect(IsPermanentError(err)).To(BeTrue())
+
+		for _, child := range children {
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(child), child)).To(Succeed())
+		}
+	})
+
+	It("should be safe to use from multiple goroutines", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				result, err := r.Prune(context.Background(), assertedBy(children...))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.Children).To(BeEmpty())
+			}()
+		}
+		wg.Wait()
+	})
+})
@@ -0,0 +1,475 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// StateObjectPrefix is the prefix of the name of objects used to store
+	// composite state. It is followed by the UID of the parent.
+	StateObjectPrefix = "composite-state-"
+	// StateKey is the key of the composite state in config maps and secrets.
+	StateKey = "state"
+)
+
+// StateStore loads and saves the composite state of a parent.
+type StateStore interface {
+	// LoadState loads the state of a parent. A parent without any state has
+	// an empty state.
+	LoadState(ctx context.Context, c client.Client, parent client.Object) (*State, error)
+	// PeekState loads the state of a parent like LoadState, but must not
+	// modify the parent or anything else, for example by migrating state.
+	PeekState(ctx context.Context, c client.Client, parent client.Object) (*State, error)
+	// SaveState saves the state of a parent. The parent may be updated.
+	SaveState(ctx context.Context, c client.Client, parent client.Object, state *State) error
+	// DeleteState removes any state stored outside of the parent.
+	DeleteState(ctx context.Context, c client.Client, parent client.Object) error
+}
+
+// WithStateStore sets where the composite state is stored.
+// By default, it is stored in the StateAnnotation on the parent.
+func WithStateStore(store StateStore) Option {
+	return func(r *Reconciler) {
+		r.stateStore = store
+	}
+}
+
+// loadState loads the composite state of the parent.
+func (r *Reconciler) loadState(ctx context.Context) (*State, error) {
+	return permanentIfUndecodable(r.stateStore.LoadState(ctx, r.client, r.parent))
+}
+
+// peekState loads the composite state of the parent without modifying the
+// parent or the store. It is used by calls which only report on the children.
+func (r *Reconciler) peekState(ctx context.Context) (*State, error) {
+	return permanentIfUndecodable(r.stateStore.PeekState(ctx, r.client, r.parent))
+}
+
+// permanentIfUndecodable makes errors decoding stored state permanent.
+func permanentIfUndecodable(state *State, err error) (*State, error) {
+	if err != nil && isDecodeError(err) {
+		return nil, &permanentError{err}
+	}
+
+	return state, err
+}
+
+// saveState saves the composite state of the parent.
+func (r *Reconciler) saveState(ctx context.Context, state *State) error {
+	return r.stateStore.SaveState(ctx, r.client, r.parent, state)
+}
+
+// decodeError is returned when stored state can't be decoded.
+type decodeError struct {
+	error
+}
+
+func isDecodeError(err error) bool {
+	_, ok := err.(*decodeError)
+	return ok
+}
+
+func decodeState(data []byte) (*State, error) {
+	var state State
+	if len(data) == 0 {
+		return &state, nil
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, &decodeError{err}
+	}
+
+	return &state, nil
+}
+
+type annotationStateStore struct{}
+
+// AnnotationStateStore stores the composite state as JSON in the
+// StateAnnotation on the parent.
+func AnnotationStateStore() StateStore {
+	return annotationStateStore{}
+}
+
+func (s annotationStateStore) PeekState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.LoadState(ctx, c, parent)
+}
+
+func (annotationStateStore) LoadState(_ context.Context, _ client.Client, parent client.Object) (*State, error) {
+	state, err := AccessState(parent).GetCompositeState()
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+
+	return state, nil
+}
+
+func (annotationStateStore) SaveState(ctx context.Context, c client.Client, parent client.Object, state *State) error {
+	original := parent.DeepCopyObject().(client.Object)
+	if err := AccessState(parent).SetCompositeState(state); err != nil {
+		return err
+	}
+
+	return c.Patch(ctx, parent, client.MergeFrom(original))
+}
+
+func (annotationStateStore) DeleteState(context.Context, client.Client, client.Object) error {
+	return nil
+}
+
+// migrateAnnotation moves state from the StateAnnotation on the parent to
+// another store. It returns nil if the parent has no annotation. Unless
+// migrate is true, the state is only decoded and nothing is modified.
+func migrateAnnotation(ctx context.Context, c client.Client, parent client.Object, store StateStore, migrate bool) (*State, error) {
+	if _, ok := parent.GetAnnotations()[StateAnnotation]; !ok {
+		return nil, nil
+	}
+
+	state, err := annotationStateStore{}.LoadState(ctx, c, parent)
+	if err != nil || !migrate {
+		return state, err
+	}
+
+	if err := store.SaveState(ctx, c, parent, state); err != nil {
+		return nil, err
+	}
+
+	original := parent.DeepCopyObject().(client.Object)
+	annotations := parent.GetAnnotations()
+	delete(annotations, StateAnnotation)
+	parent.SetAnnotations(annotations)
+
+	if err := c.Patch(ctx, parent, client.MergeFrom(original)); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+type statusStateStore struct {
+	fields []string
+}
+
+// StatusStateStore stores the composite state in a field of the parent
+// status, written through the status subresource. The fields are the path to
+// the state within the status, which defaults to `compositeState`.
+// Existing state in the StateAnnotation is migrated to the status.
+func StatusStateStore(fields ...string) StateStore {
+	if len(fields) == 0 {
+		fields = []string{"compositeState"}
+	}
+
+	return &statusStateStore{fields: append([]string{"status"}, fields...)}
+}
+
+func (s *statusStateStore) LoadState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, true)
+}
+
+func (s *statusStateStore) PeekState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, false)
+}
+
+// load loads the state of a parent, migrating state from the StateAnnotation if migrate is true.
+func (s *statusStateStore) load(ctx context.Context, c client.Client, parent client.Object, migrate bool) (*State, error) {
+	u, err := toUnstructuredParent(c, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found, err := unstructured.NestedFieldNoCopy(u.Object, s.fields...)
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+
+	if !found || value == nil {
+		if state, err := migrateAnnotation(ctx, c, parent, s, migrate); state != nil || err != nil {
+			return state, err
+		}
+
+		return &State{}, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+
+	return decodeState(data)
+}
+
+func (s *statusStateStore) SaveState(ctx context.Context, c client.Client, parent client.Object, state *State) error {
+	u, err := toUnstructuredParent(c, parent)
+	if err != nil {
+		return err
+	}
+
+	value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(state)
+	if err != nil {
+		return err
+	}
+
+	original := u.DeepCopy()
+	if err := unstructured.SetNestedMap(u.Object, value, s.fields...); err != nil {
+		return err
+	}
+
+	if err := c.Status().Patch(ctx, u, client.MergeFrom(original)); err != nil {
+		return err
+	}
+
+	return fromUnstructuredParent(u, parent)
+}
+
+func (s *statusStateStore) DeleteState(context.Context, client.Client, client.Object) error {
+	return nil
+}
+
+// toUnstructuredParent converts a parent to unstructured, with its GVK set.
+func toUnstructuredParent(c client.Client, parent client.Object) (*unstructured.Unstructured, error) {
+	if u, ok := parent.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+
+	gvk, err := apiutil.GVKForObject(parent, c.Scheme())
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(gvk)
+	return u, nil
+}
+
+// fromUnstructuredParent copies an unstructured parent back into the parent.
+func fromUnstructuredParent(u *unstructured.Unstructured, parent client.Object) error {
+	if p, ok := parent.(*unstructured.Unstructured); ok {
+		p.Object = u.Object
+		return nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, parent)
+}
+
+// objectStateStore stores state in a separate object.
+type objectStateStore struct {
+	// namespace is the namespace of the object for cluster-scoped parents.
+	// It is ignored for cluster-scoped objects.
+	namespace string
+	// clusterScoped is true if the object is cluster-scoped.
+	clusterScoped bool
+
+	newObject func() client.Object
+	getData   func(obj client.Object) ([]byte, error)
+	setData   func(obj client.Object, data []byte) error
+}
+
+// ConfigMapStateStore stores the composite state in a config map in the
+// namespace of the parent, or the given namespace for cluster-scoped
+// parents. The config map is owned by the parent wherever possible, so that
+// it is garbage collected with it. Existing state in the StateAnnotation is
+// migrated to the config map.
+func ConfigMapStateStore(namespace string) StateStore {
+	return &objectStateStore{
+		namespace: namespace,
+		newObject: func() client.Object { return &corev1.ConfigMap{} },
+		getData: func(obj client.Object) ([]byte, error) {
+			return []byte(obj.(*corev1.ConfigMap).Data[StateKey]), nil
+		},
+		setData: func(obj client.Object, data []byte) error {
+			cm := obj.(*corev1.ConfigMap)
+			cm.Data = map[string]string{StateKey: string(data)}
+			return nil
+		},
+	}
+}
+
+// SecretStateStore stores the composite state in a secret in the namespace
+// of the parent, or the given namespace for cluster-scoped parents. The
+// secret is owned by the parent wherever possible, so that it is garbage
+// collected with it. Existing state in the StateAnnotation is migrated to
+// the secret.
+func SecretStateStore(namespace string) StateStore {
+	return &objectStateStore{
+		namespace: namespace,
+		newObject: func() client.Object { return &corev1.Secret{} },
+		getData: func(obj client.Object) ([]byte, error) {
+			return obj.(*corev1.Secret).Data[StateKey], nil
+		},
+		setData: func(obj client.Object, data []byte) error {
+			secret := obj.(*corev1.Secret)
+			secret.Data = map[string][]byte{StateKey: data}
+			return nil
+		},
+	}
+}
+
+// TrackerStateStore stores the composite state in a cluster-scoped tracker
+// object of the given kind, named after the UID of the parent. The state is
+// stored as the spec of the tracker, so its schema must preserve unknown
+// fields in the spec.
+//
+// Trackers of cluster-scoped parents are owned by the parent. Trackers of
+// namespaced parents can't be, and are removed by the finalizer if one is
+// configured. Existing state in the StateAnnotation is migrated to the tracker.
+func TrackerStateStore(gvk schema.GroupVersionKind) StateStore {
+	return &objectStateStore{
+		clusterScoped: true,
+		newObject: func() client.Object {
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(gvk)
+			return u
+		},
+		getData: func(obj client.Object) ([]byte, error) {
+			spec, found, err := unstructured.NestedFieldNoCopy(obj.(*unstructured.Unstructured).Object, "spec")
+			if err != nil || !found {
+				return nil, err
+			}
+
+			return json.Marshal(spec)
+		},
+		setData: func(obj client.Object, data []byte) error {
+			var spec map[string]interface{}
+			if err := json.Unmarshal(data, &spec); err != nil {
+				return err
+			}
+
+			return unstructured.SetNestedMap(obj.(*unstructured.Unstructured).Object, spec, "spec")
+		},
+	}
+}
+
+// key returns the key of the state object of a parent.
+func (s *objectStateStore) key(parent client.Object) (client.ObjectKey, error) {
+	key := client.ObjectKey{Name: StateObjectPrefix + string(parent.GetUID())}
+
+	if s.clusterScoped {
+		return key, nil
+	}
+
+	key.Namespace = parent.GetNamespace()
+	if key.Namespace == "" {
+		key.Namespace = s.namespace
+	}
+
+	if key.Namespace == "" {
+		return key, &permanentError{fmt.Errorf("no namespace to store state of cluster-scoped parent %s", parent.GetName())}
+	}
+
+	return key, nil
+}
+
+// get fetches the state object of a parent, returning nil if it doesn't exist.
+func (s *objectStateStore) get(ctx context.Context, c client.Client, parent client.Object) (client.Object, error) {
+	key, err := s.key(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := s.newObject()
+	if err := c.Get(ctx, key, obj); apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (s *objectStateStore) LoadState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, true)
+}
+
+func (s *objectStateStore) PeekState(ctx context.Context, c client.Client, parent client.Object) (*State, error) {
+	return s.load(ctx, c, parent, false)
+}
+
+// load loads the state of a parent, migrating state from the StateAnnotation if migrate is true.
+func (s *objectStateStore) load(ctx context.Context, c client.Client, parent client.Object, migrate bool) (*State, error) {
+	obj, err := s.get(ctx, c, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj == nil {
+		if state, err := migrateAnnotation(ctx, c, parent, s, migrate); state != nil || err != nil {
+			return state, err
+		}
+
+		return &State{}, nil
+	}
+
+	data, err := s.getData(obj)
+	if err != nil {
+		return nil, &decodeError{err}
+	}
+
+	return decodeState(data)
+}
+
+func (s *objectStateStore) SaveState(ctx context.Context, c client.Client, parent client.Object, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	obj, err := s.get(ctx, c, parent)
+	if err != nil {
+		return err
+	}
+
+	if obj != nil {
+		original := obj.DeepCopyObject().(client.Object)
+		if err := s.setData(obj, data); err != nil {
+			return err
+		}
+
+		return c.Patch(ctx, obj, client.MergeFrom(original))
+	}
+
+	key, err := s.key(parent)
+	if err != nil {
+		return err
+	}
+
+	obj = s.newObject()
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+
+	if err := s.setData(obj, data); err != nil {
+		return err
+	}
+
+	// Namespaced parents can only own objects in the same namespace.
+	if parent.GetNamespace() == "" || parent.GetNamespace() == key.Namespace {
+		if err := controllerutil.SetOwnerReference(parent, obj, c.Scheme()); err != nil {
+			return err
+		}
+	}
+
+	return c.Create(ctx, obj)
+}
+
+func (s *objectStateStore) DeleteState(ctx context.Context, c client.Client, parent client.Object) error {
+	obj, err := s.get(ctx, c, parent)
+	if err != nil || obj == nil {
+		return err
+	}
+
+	return client.IgnoreNotFound(c.Delete(ctx, obj))
+}
@@ -0,0 +1,111 @@
+package composite
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("State stores", func() {
+	var ctx context.Context
+	var c client.Client
+	var parent *corev1.Service
+
+	state := &State{
+		DeployedKinds: []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}},
+		Namespaces:    []string{"default"},
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		parent = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "parent",
+				Namespace:   "default",
+				UID:         "1234",
+				Annotations: map[string]string{StateAnnotation: `{"namespaces":["old"]}`},
+			},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(parent).Build()
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(parent), parent)).To(Succeed())
+	})
+
+	Context("ConfigMapStateStore", func() {
+		It("should migrate state from the annotation", func() {
+			store := ConfigMapStateStore("")
+
+			loaded, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Namespaces).To(Equal([]string{"old"}))
+			Expect(parent.Annotations).ToNot(HaveKey(StateAnnotation))
+
+			cm := &corev1.ConfigMap{}
+			Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "composite-state-1234"}, cm)).To(Succeed())
+			Expect(cm.Data).To(HaveKey(StateKey))
+			Expect(cm.OwnerReferences).To(HaveLen(1))
+			Expect(cm.OwnerReferences[0].UID).To(Equal(parent.UID))
+		})
+
+		It("should peek at state in the annotation without migrating it", func() {
+			loaded, err := ConfigMapStateStore("").PeekState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded.Namespaces).To(Equal([]string{"old"}))
+			Expect(parent.Annotations).To(HaveKey(StateAnnotation))
+
+			cm := &corev1.ConfigMap{}
+			err = c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "composite-state-1234"}, cm)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should save and load state", func() {
+			store := ConfigMapStateStore("")
+
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+
+			loaded, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(Equal(state))
+
+			Expect(store.DeleteState(ctx, c, parent)).To(Succeed())
+			Expect(store.DeleteState(ctx, c, parent)).To(Succeed())
+		})
+	})
+
+	Context("SecretStateStore", func() {
+		It("should require a namespace for cluster-scoped parents", func() {
+			parent.Namespace = ""
+
+			_, err := SecretStateStore("").LoadState(ctx, c, parent)
+			Expect(IsPermanentError(err)).To(BeTrue())
+		})
+
+		It("should save and load state", func() {
+			store := SecretStateStore("")
+
+			Expect(store.SaveState(ctx, c, parent, state)).To(Succeed())
+
+			loaded, err := store.LoadState(ctx, c, parent)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(Equal(state))
+		})
+	})
+
+	Context("AnnotationStateStore", func() {
+		It("should fail permanently on invalid state", func() {
+			parent.Annotations[StateAnnotation] = "{"
+			r := &Reconciler{client: c, parent: parent, stateStore: AnnotationStateStore()}
+
+			_, err := r.loadState(ctx)
+			Expect(IsPermanentError(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,305 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/wellplayedgames/tiny-operator/pkg/patch"
+)
+
+const (
+	// ConditionReady is true when the last reconcile succeeded and every child is ready.
+	ConditionReady = "Ready"
+	// ConditionProgressing is true whilst children are converging or being deleted.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is true when the last reconcile failed or any child is degraded.
+	ConditionDegraded = "Degraded"
+	// ConditionPruned is true when no stale children remain.
+	ConditionPruned = "Pruned"
+	// ConditionDrifted is true when children were modified out of band and
+	// not corrected. It is only maintained if drift detection is enabled.
+	ConditionDrifted = "Drifted"
+)
+
+const (
+	reasonReconciled       = "Reconciled"
+	reasonReconcileFailed  = "ReconcileFailed"
+	reasonProgressing      = "ChildrenProgressing"
+	reasonDegraded         = "ChildrenDegraded"
+	reasonPendingDeletion  = "PendingDeletion"
+	reasonUnavailableKinds = "UnavailableKinds"
+	reasonPruned           = "Pruned"
+	reasonDrifted          = "ChildrenDrifted"
+	reasonDriftCorrected   = "DriftCorrected"
+	reasonNoDrift          = "NoDrift"
+	reasonObserveOnly      = "ObserveOnly"
+)
+
+// maxStatusChildren is the maximum number of children named in a condition message.
+const maxStatusChildren = 5
+
+// maxConditionMessage is the maximum length of a condition message accepted
+// by the API server.
+const maxConditionMessage = 32768
+
+// ResourceStatus describes a single child in the status of the parent.
+type ResourceStatus struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Namespace  string       `json:"namespace,omitempty"`
+	Name       string       `json:"name"`
+	Health     HealthStatus `json:"health,omitempty"`
+	Message    string       `json:"message,omitempty"`
+}
+
+// parentStatus is the part of the parent status maintained by the reconciler.
+type parentStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	Resources          []ResourceStatus   `json:"resources,omitempty"`
+}
+
+// parentStatusFields are the fields of the parent status owned by parentStatus.
+var parentStatusFields = []string{"observedGeneration", "conditions", "resources"}
+
+// WithStatusConditions maintains the Ready, Progressing, Degraded and Pruned
+// conditions, `observedGeneration` and a `resources` list of children and
+// their health in the status of the parent after each reconcile. The status
+// is only written if it changed. Other fields of the status are left alone.
+//
+// The parent must have a status subresource, and its status must include
+// these fields so that they are not dropped.
+func WithStatusConditions() Option {
+	return func(r *Reconciler) {
+		r.statusConditions = true
+	}
+}
+
+// updateStatus writes the outcome of a reconcile to the parent status.
+func (r *Reconciler) updateStatus(ctx context.Context, result *ReconcileResult, reconcileErr error) error {
+	u, err := toUnstructuredParent(r.client, r.parent)
+	if err != nil {
+		return err
+	}
+
+	original := u.DeepCopy()
+
+	status, _, err := unstructured.NestedMap(u.Object, "status")
+	if err != nil {
+		return err
+	}
+
+	if status == nil {
+		status = map[string]interface{}{}
+	}
+
+	current := &parentStatus{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(status, current); err != nil {
+		return err
+	}
+
+	r.setStatus(current, result, reconcileErr)
+
+	value, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range parentStatusFields {
+		if v, ok := value[field]; ok {
+			status[field] = v
+		} else {
+			delete(status, field)
+		}
+	}
+
+	if err := unstructured.SetNestedMap(u.Object, status, "status"); err != nil {
+		return err
+	}
+
+	patched, err := patch.MaybePatchStatus(ctx, r.client, u, client.MergeFrom(original))
+	if err != nil || !patched {
+		return err
+	}
+
+	return fromUnstructuredParent(u, r.parent)
+}
+
+// setStatus updates a status to describe the outcome of a reconcile.
+// The resources are only replaced if the health of the children is known.
+func (r *Reconciler) setStatus(status *parentStatus, result *ReconcileResult, reconcileErr error) {
+	generation := r.parentMeta.GetGeneration()
+	status.ObservedGeneration = generation
+
+	set := func(conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             conditionStatus,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            limitMessage(message),
+		})
+	}
+
+	progressing := childrenWithHealth(result.Health, HealthProgressing)
+	degraded := childrenWithHealth(result.Health, HealthDegraded)
+
+	switch {
+	case reconcileErr != nil:
+		set(ConditionReady, metav1.ConditionFalse, reasonReconcileFailed, reconcileErr.Error())
+		set(ConditionDegraded, metav1.ConditionTrue, reasonReconcileFailed, reconcileErr.Error())
+	case len(degraded) > 0:
+		set(ConditionReady, metav1.ConditionFalse, reasonDegraded, describeChildren(degraded))
+		set(ConditionDegraded, metav1.ConditionTrue, reasonDegraded, describeChildren(degraded))
+	case len(progressing) > 0:
+		set(ConditionReady, metav1.ConditionFalse, reasonProgressing, describeChildren(progressing))
+		set(ConditionDegraded, metav1.ConditionFalse, reasonReconciled, "")
+	default:
+		set(ConditionReady, metav1.ConditionTrue, reasonReconciled, "")
+		set(ConditionDegraded, metav1.ConditionFalse, reasonReconciled, "")
+	}
+
+	switch {
+	case len(progressing) > 0:
+		set(ConditionProgressing, metav1.ConditionTrue, reasonProgressing, describeChildren(progressing))
+	case len(result.PendingDeletion) > 0:
+		set(ConditionProgressing, metav1.ConditionTrue, reasonPendingDeletion, describePendingDeletion(result.PendingDeletion))
+	default:
+		set(ConditionProgressing, metav1.ConditionFalse, reasonReconciled, "")
+	}
+
+	switch {
+	case r.observeOnly:
+		set(ConditionPruned, metav1.ConditionUnknown, reasonObserveOnly, "Children are not pruned whilst observing only")
+	case len(result.PendingDeletion) > 0:
+		set(ConditionPruned, metav1.ConditionFalse, reasonPendingDeletion, describePendingDeletion(result.PendingDeletion))
+	case len(result.UnavailableKinds) > 0:
+		kinds := make([]string, 0, len(result.UnavailableKinds))
+		for _, gvk := range result.UnavailableKinds {
+			kinds = append(kinds, gvk.GroupKind().String())
+		}
+
+		set(ConditionPruned, metav1.ConditionFalse, reasonUnavailableKinds,
+			"Unable to prune children of kinds which are no longer served: "+strings.Join(kinds, ", "))
+	case reconcileErr != nil:
+		set(ConditionPruned, metav1.ConditionUnknown, reasonReconcileFailed, reconcileErr.Error())
+	default:
+		set(ConditionPruned, metav1.ConditionTrue, reasonPruned,
+			fmt.Sprintf("Pruned %d and orphaned %d children", len(result.Pruned), len(result.Orphaned)))
+	}
+
+	if r.detectDrift {
+		switch {
+		case len(result.Drift) > 0 && r.observeOnly:
+			set(ConditionDrifted, metav1.ConditionTrue, reasonDrifted, describeDrift(result.Drift))
+		case len(result.Drift) > 0:
+			set(ConditionDrifted, metav1.ConditionFalse, reasonDriftCorrected, "Corrected drift in "+describeDrift(result.Drift))
+		case reconcileErr != nil:
+			set(ConditionDrifted, metav1.ConditionUnknown, reasonReconcileFailed, reconcileErr.Error())
+		default:
+			set(ConditionDrifted, metav1.ConditionFalse, reasonNoDrift, "")
+		}
+	}
+
+	if reconcileErr != nil {
+		return
+	}
+
+	status.Resources = make([]ResourceStatus, 0, len(result.Health.Children))
+	for _, child := range result.Health.Children {
+		apiVersion, kind := child.Child.GroupVersionKind.ToAPIVersionAndKind()
+		status.Resources = append(status.Resources, ResourceStatus{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  child.Child.Namespace,
+			Name:       child.Child.Name,
+			Health:     child.Status,
+			Message:    child.Reason,
+		})
+	}
+}
+
+// childrenWithHealth returns the children with the given health status.
+func childrenWithHealth(health Health, status HealthStatus) []ChildHealth {
+	var children []ChildHealth
+	for _, child := range health.Children {
+		if child.Status == status {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// describeChildren summarises the health of some children in a condition message.
+func describeChildren(children []ChildHealth) string {
+	descriptions := make([]string, 0, maxStatusChildren)
+	for idx, child := range children {
+		if idx == maxStatusChildren {
+			descriptions = append(descriptions, fmt.Sprintf("and %d more", len(children)-idx))
+			break
+		}
+
+		description := child.Child.String()
+		if child.Reason != "" {
+			description += ": " + child.Reason
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// describePendingDeletion summarises children which are still being deleted.
+func describePendingDeletion(pending []PendingDeletion) string {
+	names := make([]string, 0, len(pending))
+	for _, p := range pending {
+		names = append(names, p.Child.String())
+	}
+
+	return "Waiting for deletion of " + joinLimited(names, maxStatusChildren)
+}
+
+// describeDrift summarises drifted children in a condition message.
+func describeDrift(drift []DriftedChild) string {
+	names := make([]string, 0, len(drift))
+	for _, d := range drift {
+		names = append(names, d.Child.String())
+	}
+
+	return joinLimited(names, maxStatusChildren)
+}
+
+// limitMessage truncates a condition message which is too long, such as one
+// aggregating many errors, so that the status can still be written.
+func limitMessage(message string) string {
+	if len(message) <= maxConditionMessage {
+		return message
+	}
+
+	const ellipsis = "..."
+	end := maxConditionMessage - len(ellipsis)
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+
+	return message[:end] + ellipsis
+}
+
+// joinLimited joins at most limit items with commas, summarising the rest.
+func joinLimited(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, ", ")
+	}
+
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:limit], ", "), len(items)-limit)
+}
@@ -0,0 +1,151 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Status", func() {
+	parentGVK := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Parent"}
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	var parent *unstructured.Unstructured
+	var c client.Client
+	var r *Reconciler
+
+	child := func(name string, status HealthStatus, reason string) ChildHealth {
+		return ChildHealth{
+			Child:  ChildReference{GroupVersionKind: configMap, Namespace: "default", Name: name},
+			Status: status,
+			Reason: reason,
+		}
+	}
+
+	conditionsOf := func(obj *unstructured.Unstructured) []metav1.Condition {
+		status := &parentStatus{}
+		value, _, _ := unstructured.NestedMap(obj.Object, "status")
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(value, status)).To(Succeed())
+		return status.Conditions
+	}
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		s.AddKnownTypeWithName(parentGVK, &unstructured.Unstructured{})
+
+		parent = &unstructured.Unstructured{}
+		parent.SetGroupVersionKind(parentGVK)
+		parent.SetNamespace("default")
+		parent.SetName("parent")
+		parent.SetGeneration(3)
+		Expect(unstructured.SetNestedField(parent.Object, "kept", "status", "other")).To(Succeed())
+
+		c = fake.NewClientBuilder().WithScheme(s).WithObjects(parent).Build()
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(parent), parent)).To(Succeed())
+
+		r = &Reconciler{logger: logr.Discard(), client: c, parent: parent, parentMeta: parent}
+	})
+
+	It("should write conditions, the observed generation and resources", func() {
+		result := &ReconcileResult{}
+		result.Health.Status = HealthReady
+		result.Health.add(child("a", HealthReady, ""))
+		result.Health.add(child("b", HealthReady, ""))
+
+		Expect(r.updateStatus(context.Background(), result, nil)).To(Succeed())
+
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(parentGVK)
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(parent), live)).To(Succeed())
+
+		generation, _, _ := unstructured.NestedInt64(live.Object, "status", "observedGeneration")
+		Expect(generation).To(Equal(int64(3)))
+
+		other, _, _ := unstructured.NestedString(live.Object, "status", "other")
+		Expect(other).To(Equal("kept"))
+
+		resources, _, _ := unstructured.NestedSlice(live.Object, "status", "resources")
+		Expect(resources).To(HaveLen(2))
+		Expect(resources[0]).To(Equal(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"namespace":  "default",
+			"name":       "a",
+			"health":     "Ready",
+		}))
+
+		conditions := conditionsOf(live)
+		Expect(meta.IsStatusConditionTrue(conditions, ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(conditions, ConditionPruned)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(conditions, ConditionProgressing)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(conditions, ConditionDegraded)).To(BeTrue())
+	})
+
+	It("should not write an unchanged status", func() {
+		result := &ReconcileResult{}
+		result.Health.Status = HealthReady
+
+		Expect(r.updateStatus(context.Background(), result, nil)).To(Succeed())
+		resourceVersion := parent.GetResourceVersion()
+
+		Expect(r.updateStatus(context.Background(), result, nil)).To(Succeed())
+		Expect(parent.GetResourceVersion()).To(Equal(resourceVersion))
+	})
+
+	It("should report failures and keep the previous resources", func() {
+		status := &parentStatus{
+			Resources: []ResourceStatus{{APIVersion: "v1", Kind: "ConfigMap", Name: "a", Health: HealthReady}},
+		}
+
+		r.setStatus(status, &ReconcileResult{}, errors.New("boom"))
+
+		Expect(status.Resources).To(HaveLen(1))
+		Expect(meta.IsStatusConditionFalse(status.Conditions, ConditionReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, ConditionDegraded)).To(BeTrue())
+		Expect(meta.FindStatusCondition(status.Conditions, ConditionDegraded).Message).To(Equal("boom"))
+		Expect(meta.FindStatusCondition(status.Conditions, ConditionPruned).Status).To(Equal(metav1.ConditionUnknown))
+	})
+
+	It("should truncate long failure messages", func() {
+		status := &parentStatus{}
+		r.setStatus(status, &ReconcileResult{}, errors.New(strings.Repeat("é", maxConditionMessage)))
+
+		message := meta.FindStatusCondition(status.Conditions, ConditionReady).Message
+		Expect(len(message)).To(BeNumerically("<=", maxConditionMessage))
+		Expect(utf8.ValidString(message)).To(BeTrue())
+		Expect(message).To(HaveSuffix("é..."))
+	})
+
+	It("should report progressing children and pending deletions", func() {
+		result := &ReconcileResult{
+			PendingDeletion: []PendingDeletion{{Child: child("old", HealthReady, "").Child}},
+		}
+		result.Health.Status = HealthReady
+		result.Health.add(child("a", HealthProgressing, "waiting for rollout"))
+
+		status := &parentStatus{}
+		r.setStatus(status, result, nil)
+
+		ready := meta.FindStatusCondition(status.Conditions, ConditionReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Message).To(Equal("ConfigMap default/a: waiting for rollout"))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, ConditionProgressing)).To(BeTrue())
+
+		pruned := meta.FindStatusCondition(status.Conditions, ConditionPruned)
+		Expect(pruned.Status).To(Equal(metav1.ConditionFalse))
+		Expect(pruned.Reason).To(Equal(reasonPendingDeletion))
+		Expect(pruned.ObservedGeneration).To(Equal(int64(3)))
+	})
+})
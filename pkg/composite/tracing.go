@@ -0,0 +1,117 @@
+package composite
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const tracerName = "github.com/wellplayedgames/tiny-operator/pkg/composite"
+
+const (
+	groupKey     = attribute.Key("k8s.group")
+	versionKey   = attribute.Key("k8s.version")
+	kindKey      = attribute.Key("k8s.kind")
+	namespaceKey = attribute.Key("k8s.namespace")
+	nameKey      = attribute.Key("k8s.name")
+	outcomeKey   = attribute.Key("composite.outcome")
+	healthKey    = attribute.Key("composite.health")
+)
+
+const (
+	// Outcomes recorded on child spans.
+	outcomeCreated   = "created"
+	outcomeUpdated   = "updated"
+	outcomeRecreated = "recreated"
+	outcomeUnchanged = "unchanged"
+	outcomeAdopted   = "adopted"
+	outcomeSkipped   = "skipped"
+	outcomeConflict  = "conflict"
+	outcomeDeleted   = "deleted"
+	outcomeOrphaned  = "orphaned"
+	outcomeFailed    = "failed"
+)
+
+// WithTracerProvider sets the provider of the tracer used to trace reconciles
+// and operations on children. By default, the global provider is used.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(r *Reconciler) {
+		r.tracer = provider.Tracer(tracerName)
+	}
+}
+
+func defaultTracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// objectAttributes describes an object of the given kind.
+func objectAttributes(gvk schema.GroupVersionKind, obj client.Object) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		groupKey.String(gvk.Group),
+		versionKey.String(gvk.Version),
+		kindKey.String(gvk.Kind),
+		namespaceKey.String(obj.GetNamespace()),
+		nameKey.String(obj.GetName()),
+	}
+}
+
+// startChildSpan starts a span for an operation on a child.
+func (r *Reconciler) startChildSpan(ctx context.Context, name string, child client.Object) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, name, trace.WithAttributes(objectAttributes(child.GetObjectKind().GroupVersionKind(), child)...))
+}
+
+// endSpan records the outcome of an operation and ends its span.
+func endSpan(span trace.Span, outcome string, err error) {
+	if outcome != "" {
+		span.SetAttributes(outcomeKey.String(outcome))
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// applyOutcome describes the outcome of applying a child, given the reason of
+// the event recorded for it.
+func applyOutcome(out childOutcome, reason string) string {
+	switch {
+	case out.err != nil:
+		return outcomeFailed
+	case out.conflict != nil:
+		return outcomeConflict
+	case out.skipped:
+		return outcomeSkipped
+	case reason == EventReasonRecreated:
+		return outcomeRecreated
+	case out.adopted:
+		return outcomeAdopted
+	case reason == EventReasonCreated:
+		return outcomeCreated
+	case reason == EventReasonUpdated:
+		return outcomeUpdated
+	default:
+		return outcomeUnchanged
+	}
+}
+
+// pruneOutcome describes the outcome of pruning a child.
+func pruneOutcome(item prunable, pruned bool, err error) string {
+	switch {
+	case err != nil:
+		return outcomeFailed
+	case !pruned:
+		return outcomeSkipped
+	case item.policy == PruneOrphan:
+		return outcomeOrphaned
+	default:
+		return outcomeDeleted
+	}
+}
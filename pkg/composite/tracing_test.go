@@ -0,0 +1,105 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Tracing", func() {
+	var recorder *tracetest.SpanRecorder
+	var parent *corev1.ConfigMap
+	var c client.Client
+	var r *Reconciler
+
+	spanNamed := func(name string) sdktrace.ReadOnlySpan {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+
+		Fail("no span named " + name)
+		return nil
+	}
+
+	attributesOf := func(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+		values := map[attribute.Key]string{}
+		for _, kv := range span.Attributes() {
+			values[kv.Key] = kv.Value.Emit()
+		}
+
+		return values
+	}
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		parent = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "parent", UID: "parent-uid"}}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(parent).Build()
+
+		var err error
+		r, err = New(logr.Discard(), c, scheme.Scheme, parent, "test",
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should trace reconciles and child applies", func() {
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child"}}
+		child.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+
+		// The fake client doesn't support server-side apply, so the apply fails.
+		_, err := r.Reconcile(context.Background(), []client.Object{child})
+		Expect(err).To(HaveOccurred())
+
+		reconcile := spanNamed("composite.Reconcile")
+		Expect(reconcile.Status().Code).To(Equal(codes.Error))
+		Expect(attributesOf(reconcile)).To(HaveKeyWithValue(nameKey, "parent"))
+
+		apply := spanNamed("composite.ApplyChild")
+		Expect(apply.Parent().SpanID()).To(Equal(reconcile.SpanContext().SpanID()))
+		Expect(apply.Status().Code).To(Equal(codes.Error))
+		Expect(attributesOf(apply)).To(And(
+			HaveKeyWithValue(kindKey, "ConfigMap"),
+			HaveKeyWithValue(versionKey, "v1"),
+			HaveKeyWithValue(namespaceKey, "default"),
+			HaveKeyWithValue(nameKey, "child"),
+			HaveKeyWithValue(outcomeKey, outcomeFailed),
+		))
+	})
+
+	It("should trace child deletes", func() {
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child", UID: "child-uid"}}
+		Expect(c.Create(context.Background(), child)).To(Succeed())
+		child.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+
+		items := []prunable{{obj: child, policy: PruneDelete}}
+		Expect(r.pruneWave(context.Background(), items, wave{items: []int{0}}, &ReconcileResult{})).To(Succeed())
+
+		prune := spanNamed("composite.PruneChild")
+		Expect(prune.Status().Code).To(Equal(codes.Unset))
+		Expect(attributesOf(prune)).To(And(
+			HaveKeyWithValue(kindKey, "ConfigMap"),
+			HaveKeyWithValue(nameKey, "child"),
+			HaveKeyWithValue(outcomeKey, outcomeDeleted),
+		))
+	})
+
+	It("should describe apply outcomes", func() {
+		Expect(applyOutcome(childOutcome{applied: true}, EventReasonCreated)).To(Equal(outcomeCreated))
+		Expect(applyOutcome(childOutcome{applied: true}, EventReasonUpdated)).To(Equal(outcomeUpdated))
+		Expect(applyOutcome(childOutcome{applied: true}, "")).To(Equal(outcomeUnchanged))
+		Expect(applyOutcome(childOutcome{applied: true, adopted: true}, "")).To(Equal(outcomeAdopted))
+		Expect(applyOutcome(childOutcome{skipped: true, conflict: &ConflictError{}}, "")).To(Equal(outcomeConflict))
+	})
+})
@@ -0,0 +1,308 @@
+package composite
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Transformer modifies a desired child of the given parent before it is
+// applied. The GVK of the child is always set. Children may be typed or
+// unstructured, such as those rendered from Helm charts.
+//
+// Transformers modify copies of the children passed to each call, such as
+// Plan or Reconcile, so every call transforms the children exactly once and
+// the children passed by the caller are left as they are.
+type Transformer func(parent client.Object, child client.Object) error
+
+// WithTransformers adds transformers which are run over every desired child,
+// in order, before anything else is done with the children.
+func WithTransformers(transformers ...Transformer) Option {
+	return func(r *Reconciler) {
+		r.transformers = append(r.transformers, transformers...)
+	}
+}
+
+// PodSpecPaths is the path to the pod spec of each well-known kind with one.
+// Transformers which modify pod specs only modify children of these kinds.
+var PodSpecPaths = map[schema.GroupKind][]string{
+	{Group: "", Kind: "Pod"}:                   {"spec"},
+	{Group: "", Kind: "ReplicationController"}: {"spec", "template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:         {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:        {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:       {"spec", "template", "spec"},
+	{Group: "batch", Kind: "Job"}:              {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:          {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// unprefixedKinds are kinds whose names can't be changed by NamePrefix or
+// NameSuffix, because other children refer to them by name or their name is
+// determined by their content.
+var unprefixedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}:                                    true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: true,
+}
+
+// dockerHub is the registry of images which don't name one.
+const dockerHub = "docker.io"
+
+// CommonLabels adds labels to every child. Labels already set on a child are
+// left as they are.
+func CommonLabels(labels map[string]string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		child.SetLabels(mergeStrings(child.GetLabels(), labels))
+		return nil
+	}
+}
+
+// CommonAnnotations adds annotations to every child. Annotations already set
+// on a child are left as they are.
+func CommonAnnotations(annotations map[string]string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		child.SetAnnotations(mergeStrings(child.GetAnnotations(), annotations))
+		return nil
+	}
+}
+
+// NamePrefix adds a prefix to the name of every child, except namespaces and
+// custom resource definitions. References between children are not updated.
+func NamePrefix(prefix string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		if !unprefixedKinds[child.GetObjectKind().GroupVersionKind().GroupKind()] {
+			child.SetName(prefix + child.GetName())
+		}
+		return nil
+	}
+}
+
+// NameSuffix adds a suffix to the name of every child, except namespaces and
+// custom resource definitions. References between children are not updated.
+func NameSuffix(suffix string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		if !unprefixedKinds[child.GetObjectKind().GroupVersionKind().GroupKind()] {
+			child.SetName(child.GetName() + suffix)
+		}
+		return nil
+	}
+}
+
+// DefaultNamespace puts namespaced children without a namespace in the
+// namespace of the parent. Whether a kind is namespaced is determined by the
+// given REST mapper. Children of cluster-scoped parents are left as they are.
+func DefaultNamespace(mapper meta.RESTMapper) Transformer {
+	return func(parent client.Object, child client.Object) error {
+		if child.GetNamespace() != "" || parent.GetNamespace() == "" {
+			return nil
+		}
+
+		gvk := child.GetObjectKind().GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			child.SetNamespace(parent.GetNamespace())
+		}
+		return nil
+	}
+}
+
+// RewriteImageRegistries replaces the registry of container images in the pod
+// specs of children, for example to pull from a mirror in an air-gapped
+// cluster. Registries are mapped by host, such as "docker.io" or "ghcr.io",
+// to the registry to use instead, which may include a path. The registry "*"
+// matches every registry which isn't mapped otherwise. Images which are
+// already in one of the registries used instead are left as they are.
+func RewriteImageRegistries(registries map[string]string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		return transformPodSpec(child, func(podSpec map[string]interface{}) error {
+			for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+				containers, _, err := unstructured.NestedFieldNoCopy(podSpec, field)
+				if err != nil {
+					return err
+				}
+
+				items, _ := containers.([]interface{})
+				for _, item := range items {
+					container, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
+
+					if image, ok := container["image"].(string); ok {
+						container["image"] = rewriteImage(image, registries)
+					}
+				}
+			}
+
+			return nil
+		})
+	}
+}
+
+// ImagePullSecrets adds secrets used to pull images to the pod specs of
+// children, unless they already use them.
+func ImagePullSecrets(names ...string) Transformer {
+	return func(_ client.Object, child client.Object) error {
+		return transformPodSpec(child, func(podSpec map[string]interface{}) error {
+			secrets, _, err := unstructured.NestedSlice(podSpec, "imagePullSecrets")
+			if err != nil {
+				return err
+			}
+
+			for _, name := range names {
+				if !hasSecret(secrets, name) {
+					secrets = append(secrets, map[string]interface{}{"name": name})
+				}
+			}
+
+			return unstructured.SetNestedSlice(podSpec, secrets, "imagePullSecrets")
+		})
+	}
+}
+
+// transform runs every transformer over copies of the children, in order,
+// and returns the copies. Without transformers, the children are returned.
+func (r *Reconciler) transform(children []client.Object) ([]client.Object, error) {
+	if len(r.transformers) == 0 {
+		return children, nil
+	}
+
+	transformed := make([]client.Object, 0, len(children))
+	for _, child := range children {
+		child = child.DeepCopyObject().(client.Object)
+
+		gvk, err := apiutil.GVKForObject(child, r.scheme)
+		if err != nil {
+			return nil, &permanentError{err}
+		}
+
+		child.GetObjectKind().SetGroupVersionKind(gvk)
+
+		for _, transformer := range r.transformers {
+			if err := transformer(r.parent, child); err != nil {
+				return nil, fmt.Errorf("unable to transform %s: %w", referenceTo(child), err)
+			}
+		}
+
+		transformed = append(transformed, child)
+	}
+
+	return transformed, nil
+}
+
+// transformPodSpec modifies the pod spec of a child, if its kind has one.
+// Typed children are converted to and from their unstructured representation.
+func transformPodSpec(child client.Object, fn func(podSpec map[string]interface{}) error) error {
+	path, ok := PodSpecPaths[child.GetObjectKind().GroupVersionKind().GroupKind()]
+	if !ok {
+		return nil
+	}
+
+	obj, err := toUnstructured(child)
+	if err != nil {
+		return err
+	}
+
+	value, found, err := unstructured.NestedFieldNoCopy(obj.Object, path...)
+	if err != nil || !found {
+		return err
+	}
+
+	podSpec, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s is not an object", strings.Join(path, "."))
+	}
+
+	if err := fn(podSpec); err != nil {
+		return err
+	}
+
+	if obj == child {
+		return nil
+	}
+
+	gvk := child.GetObjectKind().GroupVersionKind()
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, child); err != nil {
+		return err
+	}
+
+	child.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
+
+// rewriteImage replaces the registry of an image, if it is mapped and the
+// image hasn't been rewritten already.
+func rewriteImage(image string, registries map[string]string) string {
+	for _, target := range registries {
+		if strings.HasPrefix(image, strings.TrimSuffix(target, "/")+"/") {
+			return image
+		}
+	}
+
+	registry, repository := splitImage(image)
+
+	target, ok := registries[registry]
+	if !ok {
+		if target, ok = registries["*"]; !ok {
+			return image
+		}
+	}
+
+	return strings.TrimSuffix(target, "/") + "/" + repository
+}
+
+// splitImage splits an image into its registry and repository. Images which
+// don't name a registry are from Docker Hub, which puts official images in
+// the library namespace.
+func splitImage(image string) (registry, repository string) {
+	idx := strings.IndexByte(image, '/')
+	if idx < 0 {
+		return dockerHub, "library/" + image
+	}
+
+	host := image[:idx]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host, image[idx+1:]
+	}
+
+	return dockerHub, image
+}
+
+// hasSecret returns true if a list of secret references includes the named secret.
+func hasSecret(secrets []interface{}, name string) bool {
+	for _, item := range secrets {
+		if secret, ok := item.(map[string]interface{}); ok && secret["name"] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeStrings adds values to a map without replacing any existing values.
+func mergeStrings(existing, values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return existing
+	}
+
+	if existing == nil {
+		existing = make(map[string]string, len(values))
+	}
+
+	for k, v := range values {
+		if _, ok := existing[k]; !ok {
+			existing[k] = v
+		}
+	}
+
+	return existing
+}
@@ -0,0 +1,214 @@
+package composite
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/wellplayedgames/tiny-operator/pkg/helm"
+)
+
+const deploymentTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: ghcr.io/example/init:1.0
+      containers:
+      - name: web
+        image: nginx:1.21
+`
+
+var _ = Describe("Transform", func() {
+	var parent *corev1.ConfigMap
+	var r *Reconciler
+
+	deployment := func() *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Image: "ghcr.io/example/init:1.0"}},
+				Containers:     []corev1.Container{{Name: "web", Image: "nginx:1.21"}},
+			}}},
+		}
+	}
+
+	rendered := func() client.Object {
+		chrt := &chart.Chart{
+			Metadata:  &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "web", Version: "0.1.0"},
+			Templates: []*chart.File{{Name: "templates/deployment.yaml", Data: []byte(deploymentTemplate)}},
+		}
+
+		objects, err := helm.RenderChart(scheme.Scheme, chrt, nil, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(objects).To(HaveLen(1))
+		return objects[0]
+	}
+
+	podSpecOf := func(obj client.Object) corev1.PodSpec {
+		d, ok := obj.(*appsv1.Deployment)
+		Expect(ok).To(BeTrue())
+		return d.Spec.Template.Spec
+	}
+
+	BeforeEach(func() {
+		parent = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "parent-ns", Name: "parent"}}
+		r = &Reconciler{logger: logr.Discard(), scheme: scheme.Scheme, parent: parent}
+	})
+
+	It("should add common labels and annotations without replacing any", func() {
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"team": "child"}}}
+
+		r.transformers = []Transformer{
+			CommonLabels(map[string]string{"team": "common", "app": "example"}),
+			CommonAnnotations(map[string]string{"owner": "example"}),
+		}
+		transformed, err := r.transform([]client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(transformed[0].GetLabels()).To(Equal(map[string]string{"team": "child", "app": "example"}))
+		Expect(transformed[0].GetAnnotations()).To(Equal(map[string]string{"owner": "example"}))
+		Expect(child.Labels).To(Equal(map[string]string{"team": "child"}))
+	})
+
+	It("should add name prefixes and suffixes, except to namespaces", func() {
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config"}}
+		prefixed := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a-config"}}
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+
+		r.transformers = []Transformer{NamePrefix("a-"), NameSuffix("-b")}
+		transformed, err := r.transform([]client.Object{child, prefixed, namespace})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(transformed[0].GetName()).To(Equal("a-config-b"))
+		Expect(transformed[1].GetName()).To(Equal("a-a-config-b"))
+		Expect(transformed[2].GetName()).To(Equal("ns"))
+
+		By("transforming the same children again")
+
+		transformed, err = r.transform([]client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(transformed[0].GetName()).To(Equal("a-config-b"))
+		Expect(child.Name).To(Equal("config"))
+	})
+
+	It("should transform children once for each call", func() {
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+		c := &dryRunClient{fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).WithObjects(parent).Build()}
+		r, err := New(logr.Discard(), c, scheme.Scheme, parent, "test", WithTransformers(NamePrefix("p-")))
+		Expect(err).ToNot(HaveOccurred())
+
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "parent-ns", Name: "config"}}
+		children := []client.Object{child}
+
+		for i := 0; i < 2; i++ {
+			plan, err := r.Plan(context.Background(), children)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(plan.Creates).To(HaveLen(1))
+			Expect(plan.Creates[0].Name).To(Equal("p-config"))
+		}
+
+		Expect(child.Name).To(Equal("config"))
+	})
+
+	It("should default the namespace of namespaced children", func() {
+		mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion})
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+
+		defaulted := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "defaulted"}}
+		explicit := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "explicit"}}
+		clusterScoped := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+
+		r.transformers = []Transformer{DefaultNamespace(mapper)}
+		transformed, err := r.transform([]client.Object{defaulted, explicit, clusterScoped})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(transformed[0].GetNamespace()).To(Equal("parent-ns"))
+		Expect(transformed[1].GetNamespace()).To(Equal("other"))
+		Expect(transformed[2].GetNamespace()).To(BeEmpty())
+
+		By("failing for kinds which aren't served")
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret"}}
+		_, err = r.transform([]client.Object{secret})
+		Expect(meta.IsNoMatchError(errors.Unwrap(err))).To(BeTrue())
+	})
+
+	It("should rewrite image registries", func() {
+		registries := map[string]string{"docker.io": "mirror.example.com/hub", "localhost:5000": "mirror.example.com"}
+
+		Expect(rewriteImage("nginx:1.21", registries)).To(Equal("mirror.example.com/hub/library/nginx:1.21"))
+		Expect(rewriteImage("example/app", registries)).To(Equal("mirror.example.com/hub/example/app"))
+		Expect(rewriteImage("localhost:5000/app@sha256:abc", registries)).To(Equal("mirror.example.com/app@sha256:abc"))
+		Expect(rewriteImage("ghcr.io/example/app", registries)).To(Equal("ghcr.io/example/app"))
+
+		registries["*"] = "mirror.example.com/other/"
+		Expect(rewriteImage("ghcr.io/example/app", registries)).To(Equal("mirror.example.com/other/example/app"))
+
+		By("leaving rewritten images alone")
+
+		Expect(rewriteImage("mirror.example.com/hub/library/nginx:1.21", registries)).To(Equal("mirror.example.com/hub/library/nginx:1.21"))
+		Expect(rewriteImage("mirror.example.com/other/example/app", registries)).To(Equal("mirror.example.com/other/example/app"))
+	})
+
+	It("should transform hand-built and rendered children alike", func() {
+		r.transformers = []Transformer{
+			RewriteImageRegistries(map[string]string{"*": "mirror.example.com"}),
+			ImagePullSecrets("mirror", "mirror"),
+		}
+
+		children, err := r.transform([]client.Object{deployment(), rendered()})
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, child := range children {
+			Expect(child.GetObjectKind().GroupVersionKind()).To(Equal(appsv1.SchemeGroupVersion.WithKind("Deployment")))
+
+			spec := podSpecOf(child)
+			Expect(spec.InitContainers[0].Image).To(Equal("mirror.example.com/example/init:1.0"))
+			Expect(spec.Containers[0].Image).To(Equal("mirror.example.com/library/nginx:1.21"))
+			Expect(spec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "mirror"}}))
+		}
+	})
+
+	It("should transform unstructured children", func() {
+		child, err := toUnstructured(deployment())
+		Expect(err).ToNot(HaveOccurred())
+		child.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment"))
+
+		r.transformers = []Transformer{ImagePullSecrets("mirror")}
+		transformed, err := r.transform([]client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+
+		secrets, _, _ := unstructured.NestedSlice(transformed[0].(*unstructured.Unstructured).Object, "spec", "template", "spec", "imagePullSecrets")
+		Expect(secrets).To(Equal([]interface{}{map[string]interface{}{"name": "mirror"}}))
+	})
+
+	It("should leave children without pod specs alone", func() {
+		child := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config"}}
+
+		r.transformers = []Transformer{ImagePullSecrets("mirror")}
+		transformed, err := r.transform([]client.Object{child})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(transformed[0].(*corev1.ConfigMap).Data).To(BeNil())
+	})
+})
@@ -0,0 +1,117 @@
+package composite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultApplyResync is the default maximum time between applies of a child
+// whose desired state hasn't changed.
+const DefaultApplyResync = time.Hour
+
+// WithSkipUnchanged skips applying children whose desired state is the same
+// as when they were last applied, as long as the live child hasn't changed
+// either. A hash of the desired state of each child is recorded in the
+// inventory to tell. The live child is still read, so that its health can be
+// assessed.
+//
+// Children are applied regardless at least once per resync, which is
+// DefaultApplyResync if zero, so that changes which aren't visible in the
+// generation, such as labels, are eventually corrected. Drift detection may
+// be used to correct these changes immediately.
+func WithSkipUnchanged(resync time.Duration) Option {
+	return func(r *Reconciler) {
+		if resync == 0 {
+			resync = DefaultApplyResync
+		}
+
+		r.skipUnchanged = true
+		r.applyResync = resync
+	}
+}
+
+// desiredHash hashes the desired state of a child, as applied by the owner.
+func desiredHash(owner string, child client.Object) (string, error) {
+	obj, err := toUnstructured(child)
+	if err != nil {
+		return "", err
+	}
+
+	by, err := json.Marshal(normalizeForDiff(obj.Object))
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(owner))
+	h.Write([]byte{0})
+	h.Write(by)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// unchangedSince checks whether a child needs applying. If the child was
+// last applied with the same hash, hasn't changed since and isn't due a
+// resync, the live child is copied into the child and its inventory entry
+// is returned.
+func (r *Reconciler) unchangedSince(ctx context.Context, child client.Object, hash string, previous []InventoryEntry) (InventoryEntry, bool, error) {
+	idx := inventoryIndex(previous, referenceTo(child))
+	if idx < 0 {
+		return InventoryEntry{}, false, nil
+	}
+
+	entry := previous[idx]
+	if entry.Hash != hash || r.resyncDue(entry) {
+		return InventoryEntry{}, false, nil
+	}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(child.GetObjectKind().GroupVersionKind())
+	if err := r.client.Get(ctx, client.ObjectKeyFromObject(child), live); apierrors.IsNotFound(err) {
+		return InventoryEntry{}, false, nil
+	} else if err != nil {
+		return InventoryEntry{}, false, err
+	}
+
+	if inventoryEntryFor(live).changedSince(entry) {
+		return InventoryEntry{}, false, nil
+	}
+
+	if err := fromUnstructuredParent(live, child); err != nil {
+		return InventoryEntry{}, false, err
+	}
+
+	entry.ResourceVersion = live.GetResourceVersion()
+	return entry, true, nil
+}
+
+// resyncDue returns true if a child should be applied even if it is
+// unchanged. Resyncs are spread over a tenth of the resync period, so that
+// children applied at the same time are not all resynced at once.
+func (r *Reconciler) resyncDue(entry InventoryEntry) bool {
+	if entry.AppliedAt == nil {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(entry.UID))
+	jitter := time.Duration(h.Sum32()%1000) * r.applyResync / 10000
+
+	return time.Since(entry.AppliedAt.Time) > r.applyResync-jitter
+}
+
+// appliedEntry records the hash and time of an apply in an inventory entry.
+func appliedEntry(entry InventoryEntry, hash string) InventoryEntry {
+	appliedAt := metav1.NewTime(time.Now().Truncate(time.Second))
+	entry.Hash = hash
+	entry.AppliedAt = &appliedAt
+	return entry
+}
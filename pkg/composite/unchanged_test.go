@@ -0,0 +1,123 @@
+package composite
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Unchanged", func() {
+	var c client.Client
+	var r *Reconciler
+	var live *corev1.ConfigMap
+
+	desired := func() *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "child"},
+			Data:       map[string]string{"key": "desired"},
+		}
+		cm.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		return cm
+	}
+
+	hashOf := func(obj client.Object) string {
+		hash, err := desiredHash("test", obj)
+		Expect(err).ToNot(HaveOccurred())
+		return hash
+	}
+
+	appliedAgo := func(entry InventoryEntry, age time.Duration) InventoryEntry {
+		entry = appliedEntry(entry, hashOf(desired()))
+		entry.AppliedAt.Time = entry.AppliedAt.Add(-age)
+		return entry
+	}
+
+	BeforeEach(func() {
+		live = desired()
+		live.Data["extra"] = "set by someone else"
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live).Build()
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(live), live)).To(Succeed())
+		live.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+
+		r = &Reconciler{logger: logr.Discard(), client: c, owner: "test", skipUnchanged: true, applyResync: time.Hour}
+	})
+
+	It("should hash only the desired state", func() {
+		withServerFields := desired()
+		withServerFields.SetResourceVersion("5")
+		withServerFields.SetUID("uid")
+
+		changed := desired()
+		changed.Data["key"] = "changed"
+
+		Expect(hashOf(withServerFields)).To(Equal(hashOf(desired())))
+		Expect(hashOf(changed)).ToNot(Equal(hashOf(desired())))
+
+		otherOwner, err := desiredHash("other", desired())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(otherOwner).ToNot(Equal(hashOf(desired())))
+	})
+
+	It("should resync children which were applied long ago", func() {
+		entry := inventoryEntryFor(live)
+		Expect(r.resyncDue(entry)).To(BeTrue())
+		Expect(r.resyncDue(appliedAgo(entry, time.Minute))).To(BeFalse())
+		Expect(r.resyncDue(appliedAgo(entry, 2*time.Hour))).To(BeTrue())
+	})
+
+	It("should skip unchanged children and read them instead", func() {
+		previous := []InventoryEntry{appliedAgo(inventoryEntryFor(live), time.Minute)}
+
+		child := desired()
+		out, drift := r.assertChild(context.Background(), child, previous)
+		Expect(out.err).ToNot(HaveOccurred())
+		Expect(drift).To(BeNil())
+		Expect(out.unchanged).To(BeTrue())
+		Expect(out.entry.equal(previous[0])).To(BeTrue())
+		Expect(child.Data).To(HaveKeyWithValue("extra", "set by someone else"))
+	})
+
+	It("should apply children whose desired state changed", func() {
+		previous := []InventoryEntry{appliedAgo(inventoryEntryFor(live), time.Minute)}
+
+		child := desired()
+		child.Data["key"] = "changed"
+
+		// The fake client doesn't support server-side apply, so the apply fails.
+		out, _ := r.assertChild(context.Background(), child, previous)
+		Expect(out.unchanged).To(BeFalse())
+		Expect(out.err).To(HaveOccurred())
+	})
+
+	It("should apply children which changed since they were applied", func() {
+		previous := []InventoryEntry{appliedAgo(inventoryEntryFor(live), time.Minute)}
+
+		live.Data["key"] = "changed"
+		Expect(c.Update(context.Background(), live)).To(Succeed())
+
+		out, _ := r.assertChild(context.Background(), desired(), previous)
+		Expect(out.unchanged).To(BeFalse())
+		Expect(out.err).To(HaveOccurred())
+	})
+
+	It("should compare inventory entries by applied time", func() {
+		entry := appliedAgo(inventoryEntryFor(live), time.Minute)
+
+		same := entry
+		appliedAt := *entry.AppliedAt
+		same.AppliedAt = &appliedAt
+		Expect(entry.equal(same)).To(BeTrue())
+
+		later := appliedAgo(inventoryEntryFor(live), 0)
+		Expect(entry.equal(later)).To(BeFalse())
+		Expect(entry.equal(inventoryEntryFor(live))).To(BeFalse())
+	})
+})
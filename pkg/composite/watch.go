@@ -0,0 +1,161 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// ParentUIDField is the name of the field index of parents by UID, which is
+// used to find the parent of a child from its ParentLabel.
+const ParentUIDField = "composite.metadata.uid"
+
+// IndexParents registers the ParentUIDField index for parents of the same
+// kind as the given parent. It must be called before the cache is started.
+func IndexParents(ctx context.Context, indexer client.FieldIndexer, parent client.Object) error {
+	return indexer.IndexField(ctx, parent, ParentUIDField, func(obj client.Object) []string {
+		return []string{string(obj.GetUID())}
+	})
+}
+
+// EnqueueParent creates an event handler which enqueues the parent of a
+// child, found by the UID in its ParentLabel. Parents are looked up by the
+// ParentUIDField index, which must be registered with IndexParents on the
+// cache used by the reader. Children labelled only with the ApplySet part-of
+// label, as with WithApplySetOnly, are mapped to the parent with the matching
+// ApplySet ID label instead. Unlike owner references, this works for
+// cluster-scoped and cross-namespace children.
+func EnqueueParent(logger logr.Logger, reader client.Reader, scheme *runtime.Scheme, parent client.Object) (handler.EventHandler, error) {
+	list, err := newParentList(scheme, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler.EnqueueRequestsFromMapFunc(parentMapper(logger, reader, list)), nil
+}
+
+// WatchChildren indexes parents by UID and watches children of each of the
+// given kinds, enqueueing their parent whenever a child changes. Only the
+// metadata of children is cached. The builder should be for the same kind
+// as the parent, which is only used for its type.
+func WatchChildren(ctx context.Context, mgr manager.Manager, b *builder.Builder, parent client.Object, kinds ...schema.GroupVersionKind) (*builder.Builder, error) {
+	if err := IndexParents(ctx, mgr.GetFieldIndexer(), parent); err != nil {
+		return nil, fmt.Errorf("unable to index parents: %w", err)
+	}
+
+	enqueue, err := EnqueueParent(mgr.GetLogger().WithName("composite"), mgr.GetClient(), mgr.GetScheme(), parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gvk := range kinds {
+		child := &metav1.PartialObjectMetadata{}
+		child.SetGroupVersionKind(gvk)
+		b = b.Watches(&source.Kind{Type: child}, enqueue)
+	}
+
+	return b, nil
+}
+
+// newParentList creates an empty list of parents of the same kind and type
+// as the given parent.
+func newParentList(scheme *runtime.Scheme, parent client.Object) (client.ObjectList, error) {
+	gvk, err := apiutil.GVKForObject(parent, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine parent kind: %w", err)
+	}
+
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+
+	switch parent.(type) {
+	case *unstructured.Unstructured:
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(listGVK)
+		return list, nil
+	case *metav1.PartialObjectMetadata:
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(listGVK)
+		return list, nil
+	}
+
+	obj, err := scheme.New(listGVK)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create parent list: %w", err)
+	}
+
+	list, ok := obj.(client.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a list", listGVK)
+	}
+
+	return list, nil
+}
+
+// parentMapper maps a child to its parent, by listing parents with the UID
+// in the ParentLabel of the child, or with the ApplySet ID in its ApplySet
+// part-of label.
+func parentMapper(logger logr.Logger, reader client.Reader, list client.ObjectList) handler.MapFunc {
+	return func(child client.Object) []reconcile.Request {
+		// matches is true for parents of the child, in case the list wasn't filtered.
+		var opt client.ListOption
+		var matches func(parent metav1.Object) bool
+
+		if uid := child.GetLabels()[ParentLabel]; uid != "" {
+			opt = client.MatchingFields{ParentUIDField: uid}
+			matches = func(parent metav1.Object) bool {
+				return parent.GetUID() == types.UID(uid)
+			}
+		} else if id := child.GetLabels()[ApplySetPartOfLabel]; id != "" {
+			opt = client.MatchingLabels{ApplySetParentIDLabel: id}
+			matches = func(parent metav1.Object) bool {
+				return parent.GetLabels()[ApplySetParentIDLabel] == id
+			}
+		} else {
+			return nil
+		}
+
+		parents := list.DeepCopyObject().(client.ObjectList)
+		if err := reader.List(context.Background(), parents, opt); err != nil {
+			logger.Error(err, "unable to find parent of child", "name", child.GetName(), "namespace", child.GetNamespace())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		err := meta.EachListItem(parents, func(obj runtime.Object) error {
+			parent, err := meta.Accessor(obj)
+			if err != nil {
+				return err
+			}
+
+			if !matches(parent) {
+				return nil
+			}
+
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: parent.GetNamespace(),
+				Name:      parent.GetName(),
+			}})
+			return nil
+		})
+		if err != nil {
+			logger.Error(err, "unable to list parents of child", "name", child.GetName(), "namespace", child.GetNamespace())
+			return nil
+		}
+
+		return requests
+	}
+}
@@ -0,0 +1,122 @@
+package composite
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// recordingReader records the options of each list.
+type recordingReader struct {
+	client.Reader
+	listOptions []*client.ListOptions
+}
+
+func (r *recordingReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	options := &client.ListOptions{}
+	options.ApplyOptions(opts)
+	r.listOptions = append(r.listOptions, options)
+	return r.Reader.List(ctx, list, opts...)
+}
+
+// recordingIndexer records registered field indexes.
+type recordingIndexer struct {
+	extractors map[string]client.IndexerFunc
+}
+
+func (i *recordingIndexer) IndexField(_ context.Context, _ client.Object, field string, extract client.IndexerFunc) error {
+	i.extractors[field] = extract
+	return nil
+}
+
+var _ = Describe("Watch", func() {
+	var reader *recordingReader
+
+	BeforeEach(func() {
+		reader = &recordingReader{Reader: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "parent", UID: "parent-uid"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "b",
+				Name:      "other",
+				UID:       "other-uid",
+				Labels:    map[string]string{ApplySetParentIDLabel: "applyset-other"},
+			}},
+		).Build()}
+	})
+
+	It("should index parents by UID", func() {
+		indexer := &recordingIndexer{extractors: map[string]client.IndexerFunc{}}
+		Expect(IndexParents(context.Background(), indexer, &corev1.ConfigMap{})).To(Succeed())
+
+		Expect(indexer.extractors).To(HaveKey(ParentUIDField))
+		parent := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{UID: "parent-uid"}}
+		Expect(indexer.extractors[ParentUIDField](parent)).To(Equal([]string{"parent-uid"}))
+	})
+
+	It("should map children to their parent by UID", func() {
+		list, err := newParentList(scheme.Scheme, &corev1.ConfigMap{})
+		Expect(err).ToNot(HaveOccurred())
+		mapper := parentMapper(logr.Discard(), reader, list)
+
+		// A cluster-scoped child can't be owned by a namespaced parent.
+		child := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "child",
+			Labels: map[string]string{ParentLabel: "parent-uid"},
+		}}
+
+		Expect(mapper(child)).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "a", Name: "parent"}},
+		}))
+		Expect(reader.listOptions).To(HaveLen(1))
+		Expect(reader.listOptions[0].FieldSelector).To(Equal(fields.OneTermEqualSelector(ParentUIDField, "parent-uid")))
+	})
+
+	It("should map children to their parent by ApplySet ID", func() {
+		list, err := newParentList(scheme.Scheme, &corev1.ConfigMap{})
+		Expect(err).ToNot(HaveOccurred())
+		mapper := parentMapper(logr.Discard(), reader, list)
+
+		child := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "child",
+			Labels: map[string]string{ApplySetPartOfLabel: "applyset-other"},
+		}}
+
+		Expect(mapper(child)).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "b", Name: "other"}},
+		}))
+	})
+
+	It("should ignore children without a parent", func() {
+		list, err := newParentList(scheme.Scheme, &corev1.ConfigMap{})
+		Expect(err).ToNot(HaveOccurred())
+		mapper := parentMapper(logr.Discard(), reader, list)
+
+		Expect(mapper(&corev1.ConfigMap{})).To(BeEmpty())
+		Expect(reader.listOptions).To(BeEmpty())
+	})
+
+	It("should create lists of the same type as the parent", func() {
+		list, err := newParentList(scheme.Scheme, &corev1.ConfigMap{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(BeAssignableToTypeOf(&corev1.ConfigMapList{}))
+
+		parent := &unstructured.Unstructured{}
+		parent.SetGroupVersionKind(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"})
+		list, err = newParentList(scheme.Scheme, parent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(list).To(BeAssignableToTypeOf(&unstructured.UnstructuredList{}))
+		Expect(list.GetObjectKind().GroupVersionKind().Kind).To(Equal("WidgetList"))
+	})
+})
@@ -0,0 +1,117 @@
+package composite
+
+import (
+	"sort"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// WaveAnnotation is the key of the annotation used to explicitly place a child resource in an apply wave.
+	// Waves are applied in ascending order and torn down in descending order.
+	WaveAnnotation = "hive.wellplayed.games/composite-wave"
+)
+
+const (
+	// WaveNamespaces is the default wave for namespaces.
+	WaveNamespaces = iota * 10
+	// WaveDefinitions is the default wave for custom resource definitions.
+	WaveDefinitions
+	// WaveRBAC is the default wave for service accounts, roles and role bindings.
+	WaveRBAC
+	// WaveConfig is the default wave for config maps and secrets.
+	WaveConfig
+	// WaveDefault is the wave for any kind without a default order.
+	WaveDefault
+	// WaveWorkloads is the default wave for workloads.
+	WaveWorkloads
+)
+
+// DefaultKindWaves is the default wave of each well-known kind. Kinds which
+// are not listed are applied in WaveDefault.
+var DefaultKindWaves = map[schema.GroupKind]int{
+	{Group: "", Kind: "Namespace"}: WaveNamespaces,
+
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: WaveDefinitions,
+
+	{Group: "", Kind: "ServiceAccount"}:                              WaveRBAC,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:        WaveRBAC,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: WaveRBAC,
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:               WaveRBAC,
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        WaveRBAC,
+
+	{Group: "", Kind: "ConfigMap"}: WaveConfig,
+	{Group: "", Kind: "Secret"}:    WaveConfig,
+
+	{Group: "", Kind: "Pod"}:                   WaveWorkloads,
+	{Group: "", Kind: "ReplicationController"}: WaveWorkloads,
+	{Group: "apps", Kind: "Deployment"}:        WaveWorkloads,
+	{Group: "apps", Kind: "DaemonSet"}:         WaveWorkloads,
+	{Group: "apps", Kind: "ReplicaSet"}:        WaveWorkloads,
+	{Group: "apps", Kind: "StatefulSet"}:       WaveWorkloads,
+	{Group: "batch", Kind: "Job"}:              WaveWorkloads,
+	{Group: "batch", Kind: "CronJob"}:          WaveWorkloads,
+}
+
+// WaveFunc determines the apply wave of a child resource.
+// It should return false if it does not have an opinion on the child.
+type WaveFunc func(gvk schema.GroupVersionKind, obj metav1.Object) (int, bool)
+
+// waveOf determines the wave of a child from, in order of precedence, its
+// wave annotation, the configured WaveFunc and the default kind order.
+func (r *Reconciler) waveOf(gvk schema.GroupVersionKind, obj metav1.Object) int {
+	if text, ok := obj.GetAnnotations()[WaveAnnotation]; ok {
+		if wave, err := strconv.Atoi(text); err == nil {
+			return wave
+		}
+
+		r.logger.Info("ignoring invalid wave annotation", "kind", gvk.Kind, "name", obj.GetName(), "wave", text)
+	}
+
+	if r.waveFunc != nil {
+		if wave, ok := r.waveFunc(gvk, obj); ok {
+			return wave
+		}
+	}
+
+	if wave, ok := DefaultKindWaves[gvk.GroupKind()]; ok {
+		return wave
+	}
+
+	return WaveDefault
+}
+
+// wave is a group of children which are applied together.
+type wave struct {
+	order int
+	items []int
+}
+
+// groupWaves groups item indices by wave, in ascending wave order. The
+// relative order of items within a wave is preserved.
+func groupWaves(orders []int) []wave {
+	var waves []wave
+
+	for idx, order := range orders {
+		found := false
+		for w := range waves {
+			if waves[w].order == order {
+				waves[w].items = append(waves[w].items, idx)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			waves = append(waves, wave{order: order, items: []int{idx}})
+		}
+	}
+
+	sort.SliceStable(waves, func(i, j int) bool {
+		return waves[i].order < waves[j].order
+	})
+
+	return waves
+}
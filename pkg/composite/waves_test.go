@@ -0,0 +1,63 @@
+package composite
+
+import (
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Waves", func() {
+	var r *Reconciler
+
+	BeforeEach(func() {
+		r = &Reconciler{logger: logr.Discard()}
+	})
+
+	Context("groupWaves", func() {
+		It("should group items in ascending wave order", func() {
+			waves := groupWaves([]int{WaveWorkloads, WaveNamespaces, WaveWorkloads, WaveConfig})
+			Expect(waves).To(Equal([]wave{
+				{order: WaveNamespaces, items: []int{1}},
+				{order: WaveConfig, items: []int{3}},
+				{order: WaveWorkloads, items: []int{0, 2}},
+			}))
+		})
+
+		It("should return nothing for no items", func() {
+			Expect(groupWaves(nil)).To(BeEmpty())
+		})
+	})
+
+	Context("waveOf", func() {
+		deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+		It("should use the default kind order", func() {
+			Expect(r.waveOf(deployment, &metav1.ObjectMeta{})).To(Equal(WaveWorkloads))
+			Expect(r.waveOf(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, &metav1.ObjectMeta{})).
+				To(Equal(WaveNamespaces))
+		})
+
+		It("should use the default wave for unknown kinds", func() {
+			gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+			Expect(r.waveOf(gvk, &metav1.ObjectMeta{})).To(Equal(WaveDefault))
+		})
+
+		It("should prefer the wave annotation", func() {
+			r.waveFunc = func(schema.GroupVersionKind, metav1.Object) (int, bool) { return 7, true }
+			obj := &metav1.ObjectMeta{Annotations: map[string]string{WaveAnnotation: "-5"}}
+			Expect(r.waveOf(deployment, obj)).To(Equal(-5))
+		})
+
+		It("should prefer the wave function over the default order", func() {
+			r.waveFunc = func(schema.GroupVersionKind, metav1.Object) (int, bool) { return 7, true }
+			Expect(r.waveOf(deployment, &metav1.ObjectMeta{})).To(Equal(7))
+		})
+
+		It("should ignore an invalid wave annotation", func() {
+			obj := &metav1.ObjectMeta{Annotations: map[string]string{WaveAnnotation: "soon"}}
+			Expect(r.waveOf(deployment, obj)).To(Equal(WaveWorkloads))
+		})
+	})
+})
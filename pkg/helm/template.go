@@ -2,11 +2,16 @@ package helm
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"path"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strings"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/engine"
@@ -17,10 +22,51 @@ import (
 
 const (
 	notesFilename = "NOTES.txt"
+	tracerName    = "github.com/wellplayedgames/tiny-operator/pkg/helm"
 )
 
 // RenderChart renders a helm chart into an array of Kubernetes objects.
 func RenderChart(scheme *runtime.Scheme, chrt *chart.Chart, values map[string]interface{}, namespace string) ([]client.Object, error) {
+	return RenderChartContext(context.Background(), scheme, chrt, values, namespace)
+}
+
+// RenderChartContext is like RenderChart, but traces rendering as part of the
+// trace in the context, using the tracer provider of the span in the context,
+// or the global tracer provider if there is none.
+func RenderChartContext(ctx context.Context, scheme *runtime.Scheme, chrt *chart.Chart, values map[string]interface{}, namespace string) ([]client.Object, error) {
+	attributes := []attribute.KeyValue{
+		attribute.String("helm.chart", chrt.Name()),
+		attribute.String("k8s.namespace", namespace),
+	}
+	if chrt.Metadata != nil {
+		attributes = append(attributes, attribute.String("helm.chart_version", chrt.Metadata.Version))
+	}
+
+	_, span := tracer(ctx).Start(ctx, "helm.RenderChart", trace.WithAttributes(attributes...))
+	defer span.End()
+
+	objects, err := renderChart(scheme, chrt, values, namespace)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("helm.objects", len(objects)))
+	return objects, nil
+}
+
+// tracer returns a tracer from the provider of the span in the context, or
+// from the global provider if the context has no span.
+func tracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(tracerName)
+	}
+
+	return otel.Tracer(tracerName)
+}
+
+func renderChart(scheme *runtime.Scheme, chrt *chart.Chart, values map[string]interface{}, namespace string) ([]client.Object, error) {
 	options := chartutil.ReleaseOptions{
 		Name:      "RELEASE-NAME",
 		Namespace: namespace,
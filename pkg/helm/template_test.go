@@ -1,8 +1,14 @@
 package helm
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	corev1 "k8s.io/api/core/v1"
@@ -35,4 +41,44 @@ var _ = Describe("RenderChart", func() {
 			}
 		}
 	})
+
+	It("should trace rendering", func() {
+		recorder := tracetest.NewSpanRecorder()
+		previous := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(previous)
+
+		values := map[string]interface{}{
+			"ham": "crossword",
+		}
+		_, err := RenderChartContext(context.Background(), scheme, chrt, values, namespace)
+		Expect(err).ToNot(HaveOccurred())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("helm.RenderChart"))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			attribute.String("helm.chart", chrt.Name()),
+			attribute.String("k8s.namespace", namespace),
+			attribute.Int("helm.objects", 2),
+		))
+	})
+
+	It("should trace rendering with the tracer provider of the span in the context", func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+		values := map[string]interface{}{
+			"ham": "crossword",
+		}
+		_, err := RenderChartContext(ctx, scheme, chrt, values, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		parent.End()
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name()).To(Equal("helm.RenderChart"))
+		Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	})
 })
@@ -3,9 +3,16 @@ package patch
 import (
 	"context"
 	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const tracerName = "github.com/wellplayedgames/tiny-operator/pkg/patch"
+
 // IsPatchRequired determines if a patch will produce a no-op
 func IsPatchRequired(newObj client.Object, patch client.Patch) (bool, error) {
 	p, err := patch.Data(newObj)
@@ -17,7 +24,10 @@ func IsPatchRequired(newObj client.Object, patch client.Patch) (bool, error) {
 }
 
 // MaybePatch will patch an object if the patch does not produce a no-op
-func MaybePatch(ctx context.Context, client client.Client, newObj client.Object, patch client.Patch) (bool, error) {
+func MaybePatch(ctx context.Context, client client.Client, newObj client.Object, patch client.Patch) (patched bool, err error) {
+	ctx, span := startSpan(ctx, "patch.MaybePatch", newObj)
+	defer func() { endSpan(span, patched, err) }()
+
 	required, err := IsPatchRequired(newObj, patch)
 	if err != nil {
 		return false, fmt.Errorf("unable to build patch: %v", err)
@@ -31,7 +41,10 @@ func MaybePatch(ctx context.Context, client client.Client, newObj client.Object,
 }
 
 // MaybePatchStatus will patch an object's status if the patch does not produce a no-op
-func MaybePatchStatus(ctx context.Context, client client.Client, newObj client.Object, patch client.Patch) (bool, error) {
+func MaybePatchStatus(ctx context.Context, client client.Client, newObj client.Object, patch client.Patch) (patched bool, err error) {
+	ctx, span := startSpan(ctx, "patch.MaybePatchStatus", newObj)
+	defer func() { endSpan(span, patched, err) }()
+
 	required, err := IsPatchRequired(newObj, patch)
 	if err != nil {
 		return false, fmt.Errorf("unable to build patch: %v", err)
@@ -43,3 +56,42 @@ func MaybePatchStatus(ctx context.Context, client client.Client, newObj client.O
 
 	return true, client.Status().Patch(ctx, newObj, patch)
 }
+
+// startSpan starts a span for patching an object, using the tracer provider
+// of the span in the context, or the global tracer provider if there is none.
+func startSpan(ctx context.Context, name string, obj client.Object) (context.Context, trace.Span) {
+	var attributes []attribute.KeyValue
+	if obj != nil {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		attributes = []attribute.KeyValue{
+			attribute.String("k8s.group", gvk.Group),
+			attribute.String("k8s.version", gvk.Version),
+			attribute.String("k8s.kind", gvk.Kind),
+			attribute.String("k8s.namespace", obj.GetNamespace()),
+			attribute.String("k8s.name", obj.GetName()),
+		}
+	}
+
+	return tracer(ctx).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// tracer returns a tracer from the provider of the span in the context, so
+// that patches are traced alongside their callers, or from the global
+// provider if the context has no span.
+func tracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(tracerName)
+	}
+
+	return otel.Tracer(tracerName)
+}
+
+func endSpan(span trace.Span, patched bool, err error) {
+	span.SetAttributes(attribute.Bool("patch.patched", patched))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
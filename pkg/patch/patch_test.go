@@ -5,6 +5,12 @@ import (
 	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -280,3 +286,65 @@ func makeTestService() *corev1.Service {
 		},
 	}
 }
+
+var _ = Describe("Tracing", func() {
+	var recorder *tracetest.SpanRecorder
+	var previous trace.TracerProvider
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		previous = otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(previous)
+	})
+
+	It("should trace patches", func() {
+		originalObject := makeTestService()
+		changedObject := originalObject.DeepCopy()
+		changedObject.Labels = labels.Set{
+			"deployment": "best-deployment",
+		}
+
+		_, err := MaybePatch(context.Background(), newFakeClient(), changedObject, client.MergeFrom(originalObject))
+		Expect(err).To(Succeed(), "should not fail")
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("patch.MaybePatch"))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			attribute.String("k8s.name", changedObject.Name),
+			attribute.Bool("patch.patched", true),
+		))
+	})
+
+	It("should use the tracer provider of the span in the context", func() {
+		parentRecorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(parentRecorder))
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+		originalObject := makeTestService()
+		_, err := MaybePatch(ctx, newFakeClient(), originalObject.DeepCopy(), client.MergeFrom(originalObject))
+		Expect(err).To(Succeed(), "should not fail")
+		parent.End()
+
+		Expect(recorder.Ended()).To(BeEmpty())
+
+		spans := parentRecorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name()).To(Equal("patch.MaybePatch"))
+		Expect(spans[0].Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+	})
+
+	It("should record errors", func() {
+		_, err := MaybePatchStatus(context.Background(), newFakeClient(), nil, brokenPatcher{})
+		Expect(err).ToNot(Succeed(), "should fail")
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("patch.MaybePatchStatus"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+	})
+})